@@ -0,0 +1,65 @@
+package vpx
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// activeMapBlockSize is the edge length in pixels of an active map block.
+const activeMapBlockSize = 16
+
+// DiffActiveMap compares two frames of the same format and size and returns
+// an active map, indexed [row][col] with one entry per 16x16 macroblock, in
+// which a block is active if any of its samples differs by more than
+// threshold between prev and cur. The result can be passed to
+// Encoder.SetActiveMap before encoding cur so that static regions are skipped.
+func DiffActiveMap(prev, cur *Image, threshold int) ([][]bool, error) {
+	if prev == nil || cur == nil {
+		return nil, fmt.Errorf("%w: nil image", ErrCodecInvalidParam)
+	}
+	if prev.Fmt != cur.Fmt || prev.DW != cur.DW || prev.DH != cur.DH {
+		return nil, fmt.Errorf("%w: cannot diff %s %dx%d against %s %dx%d", ErrCodecInvalidParam,
+			prev.Fmt, prev.DW, prev.DH, cur.Fmt, cur.DW, cur.DH)
+	}
+	if cur.Fmt&ImageFormatHighbitdepth != 0 {
+		return nil, fmt.Errorf("%w: cannot diff high bitdepth %s images", ErrCodecInvalidParam, cur.Fmt)
+	}
+
+	rows := (int(cur.DH) + activeMapBlockSize - 1) / activeMapBlockSize
+	cols := (int(cur.DW) + activeMapBlockSize - 1) / activeMapBlockSize
+	mask := make([][]bool, rows)
+	for r := range mask {
+		mask[r] = make([]bool, cols)
+	}
+
+	for _, plane := range []int{PlaneY, PlaneU, PlaneV} {
+		if prev.Planes[plane] == nil || cur.Planes[plane] == nil {
+			continue
+		}
+		xShift, yShift := 0, 0
+		if plane != PlaneY {
+			xShift, yShift = int(cur.XChromaShift), int(cur.YChromaShift)
+		}
+		planeH, planeW := planeRows(cur, plane), planeCols(cur, plane)
+		prevStride, curStride := int(prev.Stride[plane]), int(cur.Stride[plane])
+		prevData := unsafe.Slice(prev.Planes[plane], prevStride*(planeH-1)+planeW)
+		curData := unsafe.Slice(cur.Planes[plane], curStride*(planeH-1)+planeW)
+
+		for y := 0; y < planeH; y++ {
+			row := mask[(y<<yShift)/activeMapBlockSize]
+			prevRow := prevData[y*prevStride:]
+			curRow := curData[y*curStride:]
+			for x := 0; x < planeW; x++ {
+				col := (x << xShift) / activeMapBlockSize
+				if row[col] {
+					continue
+				}
+				diff := int(prevRow[x]) - int(curRow[x])
+				if diff > threshold || -diff > threshold {
+					row[col] = true
+				}
+			}
+		}
+	}
+	return mask, nil
+}
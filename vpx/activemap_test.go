@@ -0,0 +1,202 @@
+package vpx
+
+import (
+	"errors"
+	"testing"
+	"unsafe"
+)
+
+func TestDiffActiveMap(t *testing.T) {
+	prev := ImageAlloc(nil, ImageFormatI420, 64, 48, 1)
+	defer ImageFree(prev)
+	prev.Deref()
+	cur := ImageAlloc(nil, ImageFormatI420, 64, 48, 1)
+	defer ImageFree(cur)
+	cur.Deref()
+	fillTestPattern(prev, 0)
+	fillTestPattern(cur, 0)
+
+	mask, err := DiffActiveMap(prev, cur, 0)
+	if err != nil {
+		t.Fatalf("DiffActiveMap failed: %v", err)
+	}
+	if len(mask) != 3 || len(mask[0]) != 4 {
+		t.Fatalf("mask is %dx%d, want 3x4", len(mask), len(mask[0]))
+	}
+	if n := countActive(mask); n != 0 {
+		t.Errorf("identical frames have %d active blocks, want 0", n)
+	}
+
+	// Change one luma sample in block (1, 2) and one chroma sample in block (2, 3).
+	y := unsafe.Slice(cur.Planes[PlaneY], int(cur.Stride[PlaneY])*48)
+	y[20*int(cur.Stride[PlaneY])+40] += 10
+	v := unsafe.Slice(cur.Planes[PlaneV], int(cur.Stride[PlaneV])*24)
+	v[20*int(cur.Stride[PlaneV])+30] += 3
+
+	mask, err = DiffActiveMap(prev, cur, 0)
+	if err != nil {
+		t.Fatalf("DiffActiveMap failed: %v", err)
+	}
+	if n := countActive(mask); n != 2 || !mask[1][2] || !mask[2][3] {
+		t.Errorf("mask = %v, want blocks (1, 2) and (2, 3) active", mask)
+	}
+
+	mask, err = DiffActiveMap(prev, cur, 5)
+	if err != nil {
+		t.Fatalf("DiffActiveMap failed: %v", err)
+	}
+	if n := countActive(mask); n != 1 || !mask[1][2] {
+		t.Errorf("mask with threshold 5 = %v, want only block (1, 2) active", mask)
+	}
+}
+
+func TestDiffActiveMapMismatch(t *testing.T) {
+	a := ImageAlloc(nil, ImageFormatI420, 64, 48, 1)
+	defer ImageFree(a)
+	a.Deref()
+	b := ImageAlloc(nil, ImageFormatI420, 32, 48, 1)
+	defer ImageFree(b)
+	b.Deref()
+
+	if _, err := DiffActiveMap(a, b, 0); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("size mismatch error = %v, want ErrCodecInvalidParam", err)
+	}
+	if _, err := DiffActiveMap(a, nil, 0); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("nil image error = %v, want ErrCodecInvalidParam", err)
+	}
+}
+
+func TestEncoderActiveMapRoundTrip(t *testing.T) {
+	enc := newRealtimeEncoder(t, CodecVP9)
+	// Keyframes discard the active map, so start with one.
+	encodeOneFrame(t, enc, 0)
+
+	mask := newActiveMask(15, 20, false)
+	mask[3][4] = true
+	mask[14][19] = true
+	if err := enc.SetActiveMap(mask); err != nil {
+		t.Fatalf("SetActiveMap failed: %v", err)
+	}
+	encodeOneFrame(t, enc, 1)
+	got, err := enc.ActiveMap()
+	if err != nil {
+		t.Fatalf("ActiveMap failed: %v", err)
+	}
+	if n := countActive(got); n != 2 || !got[3][4] || !got[14][19] {
+		t.Errorf("ActiveMap has %d active blocks, want (3, 4) and (14, 19)", n)
+	}
+
+	if err := enc.SetActiveMap(nil); err != nil {
+		t.Fatalf("SetActiveMap(nil) failed: %v", err)
+	}
+	encodeOneFrame(t, enc, 2)
+	got, err = enc.ActiveMap()
+	if err != nil {
+		t.Fatalf("ActiveMap failed: %v", err)
+	}
+	if n := countActive(got); n != 15*20 {
+		t.Errorf("cleared ActiveMap has %d active blocks, want %d", n, 15*20)
+	}
+}
+
+func TestEncoderActiveMapSkipsStaticBlocks(t *testing.T) {
+	for _, codec := range []Codec{CodecVP8, CodecVP9} {
+		t.Run(codec.String(), func(t *testing.T) {
+			sizes := make([]int, 2)
+			for i, active := range []bool{true, false} {
+				enc := newRealtimeEncoder(t, codec)
+				img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+				defer ImageFree(img)
+				img.Deref()
+
+				for frame := 0; frame < 5; frame++ {
+					if frame == 1 {
+						if err := enc.SetActiveMap(newActiveMask(15, 20, active)); err != nil {
+							t.Fatalf("SetActiveMap failed: %v", err)
+						}
+					}
+					fillTestPattern(img, frame)
+					pkts, err := enc.Encode(img, CodecPts(frame), 0)
+					if err != nil {
+						t.Fatalf("Encode failed: %v", err)
+					}
+					if frame > 0 {
+						for _, pkt := range pkts {
+							sizes[i] += len(pkt.Data)
+						}
+					}
+				}
+			}
+			if sizes[1]*2 > sizes[0] {
+				t.Errorf("inactive frames used %d bytes, want well below %d for active frames", sizes[1], sizes[0])
+			}
+		})
+	}
+}
+
+func TestEncoderSetActiveMapSize(t *testing.T) {
+	enc := newTestEncoder(t, CodecVP8)
+
+	if err := enc.SetActiveMap(newActiveMask(14, 20, true)); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("short mask error = %v, want ErrCodecInvalidParam", err)
+	}
+	if err := enc.SetActiveMap(newActiveMask(15, 21, true)); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("wide mask error = %v, want ErrCodecInvalidParam", err)
+	}
+}
+
+// newRealtimeEncoder returns a 320x240 encoder without lag using the
+// DlRealtime deadline, which VP9 requires for active and ROI maps.
+func newRealtimeEncoder(t *testing.T, codec Codec) *Encoder {
+	t.Helper()
+
+	enc, err := NewEncoder(codec, EncoderOptions{
+		Width:    320,
+		Height:   240,
+		Bitrate:  500,
+		Deadline: DlRealtime,
+		Configure: func(cfg *CodecEncCfg) {
+			cfg.GLagInFrames = 0
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	t.Cleanup(func() { enc.Close() })
+	return enc
+}
+
+func encodeOneFrame(t *testing.T, enc *Encoder, pts CodecPts) {
+	t.Helper()
+
+	img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+	defer ImageFree(img)
+	img.Deref()
+	fillTestPattern(img, int(pts))
+	if _, err := enc.Encode(img, pts, 0); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+}
+
+func newActiveMask(rows, cols int, active bool) [][]bool {
+	mask := make([][]bool, rows)
+	for r := range mask {
+		mask[r] = make([]bool, cols)
+		for c := range mask[r] {
+			mask[r][c] = active
+		}
+	}
+	return mask
+}
+
+func countActive(mask [][]bool) int {
+	var n int
+	for _, row := range mask {
+		for _, active := range row {
+			if active {
+				n++
+			}
+		}
+	}
+	return n
+}
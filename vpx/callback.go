@@ -0,0 +1,359 @@
+package vpx
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../include
+#cgo LDFLAGS: -L${SRCDIR}/../lib -lvpx
+#include <stdlib.h>
+#include <vpx/vpx_decoder.h>
+#include <vpx/vpx_encoder.h>
+#include <vpx/vpx_frame_buffer.h>
+#include <vpx/vp8cx.h>
+#include <vpx/vp8dx.h>
+
+extern void goPutFrameCallback(void *user_priv, vpx_image_t *img);
+extern void goPutSliceCallback(void *user_priv, vpx_image_t *img, vpx_image_rect_t *valid, vpx_image_rect_t *update);
+extern int goGetFrameBufferCallback(void *priv, size_t min_size, vpx_codec_frame_buffer_t *fb);
+extern int goReleaseFrameBufferCallback(void *priv, vpx_codec_frame_buffer_t *fb);
+extern void goOutputCxPktCallback(vpx_codec_cx_pkt_t *pkt, void *user_data);
+extern void goDecryptCallback(void *decrypt_state, unsigned char *input, unsigned char *output, int count);
+
+static vpx_codec_err_t register_cx_callback(vpx_codec_ctx_t *ctx, void *user_priv, int enable) {
+	vpx_codec_priv_output_cx_pkt_cb_pair_t pair = {enable ? goOutputCxPktCallback : NULL, user_priv};
+	return vpx_codec_control_(ctx, VP9E_REGISTER_CX_CALLBACK, &pair);
+}
+
+static void decrypt_callback(void *decrypt_state, const unsigned char *input, unsigned char *output, int count) {
+	goDecryptCallback(decrypt_state, (unsigned char *)input, output, count);
+}
+
+static vpx_codec_err_t set_decryptor(vpx_codec_ctx_t *ctx, void *decrypt_state, int enable) {
+	vpx_decrypt_init init = {enable ? decrypt_callback : NULL, decrypt_state};
+	return vpx_codec_control_(ctx, VPXD_SET_DECRYPTOR, &init);
+}
+*/
+import "C"
+import (
+	"runtime/cgo"
+	"sync"
+	"unsafe"
+)
+
+// PutFrameFunc receives every frame a decoder completes, as registered by
+// RegisterPutFrameCallback. img is only valid during the call.
+type PutFrameFunc func(img *Image)
+
+// PutSliceFunc receives the parts of a frame a decoder has completed, as
+// registered by RegisterPutSliceCallback. valid is the region of img that
+// is decoded so far and update the region decoded since the last call.
+// img is only valid during the call.
+type PutSliceFunc func(img *Image, valid, update *ImageRect)
+
+// GetFrameBufferFunc provides a zeroed frame buffer of at least minSize
+// bytes by setting fb.Data, and optionally fb.Priv, and returns 0. It returns a
+// negative value if no buffer is available. libvpx keeps fb.Data and
+// fb.Priv after the call returns, so they must point to C memory or to Go
+// memory pinned with a runtime.Pinner until the buffer is released.
+type GetFrameBufferFunc func(minSize int, fb *CodecFrameBuffer) int
+
+// ReleaseFrameBufferFunc takes back a buffer handed out by the matching
+// GetFrameBufferFunc once libvpx no longer uses it. It returns 0 on success.
+type ReleaseFrameBufferFunc func(fb *CodecFrameBuffer) int
+
+// OutputPacketFunc receives every packet an encoder produces, as
+// registered by RegisterOutputPacketCallback. pkt is only valid during the
+// call.
+type OutputPacketFunc func(pkt *CodecCxPkt)
+
+// DecryptFunc writes the decryption of input to output, which has the same
+// length, as registered by SetDecryptCallback. input points into the data
+// passed to CodecDecode. Both slices are only valid during the call.
+type DecryptFunc func(input, output []byte)
+
+// codecCallbacks holds the Go callbacks registered on one codec context.
+// libvpx passes priv, C memory holding the handle of the struct, back to
+// the exported trampolines as user data, so every context resolves its own
+// callbacks.
+type codecCallbacks struct {
+	handle cgo.Handle
+	priv   unsafe.Pointer
+
+	mu                 sync.Mutex
+	putFrame           PutFrameFunc
+	putSlice           PutSliceFunc
+	getFrameBuffer     GetFrameBufferFunc
+	releaseFrameBuffer ReleaseFrameBufferFunc
+	outputPacket       OutputPacketFunc
+	decrypt            DecryptFunc
+}
+
+var (
+	callbacksMu sync.Mutex
+	callbacks   = map[*CodecCtx]*codecCallbacks{}
+)
+
+// callbacksFor returns the callbacks of ctx, creating them if needed.
+func callbacksFor(ctx *CodecCtx) *codecCallbacks {
+	callbacksMu.Lock()
+	defer callbacksMu.Unlock()
+	if cbs, ok := callbacks[ctx]; ok {
+		return cbs
+	}
+	cbs := &codecCallbacks{}
+	cbs.handle = cgo.NewHandle(cbs)
+	cbs.priv = C.malloc(C.size_t(unsafe.Sizeof(cbs.handle)))
+	*(*cgo.Handle)(cbs.priv) = cbs.handle
+	callbacks[ctx] = cbs
+	return cbs
+}
+
+// lookupCallbacks resolves the user data passed to a trampoline.
+func lookupCallbacks(priv unsafe.Pointer) *codecCallbacks {
+	return (*(*cgo.Handle)(priv)).Value().(*codecCallbacks)
+}
+
+// set runs update under the lock, then registers the callbacks with libvpx
+// through register. update is undone if libvpx rejects them.
+func (cbs *codecCallbacks) set(update func(), register func() CodecErr) CodecErr {
+	cbs.mu.Lock()
+	putFrame, putSlice := cbs.putFrame, cbs.putSlice
+	getFrameBuffer, releaseFrameBuffer := cbs.getFrameBuffer, cbs.releaseFrameBuffer
+	outputPacket, decrypt := cbs.outputPacket, cbs.decrypt
+	update()
+	cbs.mu.Unlock()
+	err := register()
+	if err != CodecOk {
+		cbs.mu.Lock()
+		cbs.putFrame, cbs.putSlice = putFrame, putSlice
+		cbs.getFrameBuffer, cbs.releaseFrameBuffer = getFrameBuffer, releaseFrameBuffer
+		cbs.outputPacket, cbs.decrypt = outputPacket, decrypt
+		cbs.mu.Unlock()
+	}
+	return err
+}
+
+// RegisterPutFrameCallback registers fn to receive the frames decoded by
+// ctx as soon as they are complete. Every context keeps its own callback.
+// The codec must have CodecCapPutFrame.
+// Release the registration with UnregisterCallbacks after CodecDestroy.
+func RegisterPutFrameCallback(ctx *CodecCtx, fn PutFrameFunc) CodecErr {
+	if fn == nil {
+		return CodecInvalidParam
+	}
+	cbs := callbacksFor(ctx)
+	return cbs.set(func() { cbs.putFrame = fn }, func() CodecErr {
+		return CodecErr(C.vpx_codec_register_put_frame_cb((*C.vpx_codec_ctx_t)(unsafe.Pointer(ctx)),
+			C.vpx_codec_put_frame_cb_fn_t(C.goPutFrameCallback), cbs.priv))
+	})
+}
+
+// RegisterPutSliceCallback registers fn to receive the parts of the frames
+// decoded by ctx as they are completed. Every context keeps its own
+// callback. The codec must have CodecCapPutSlice. Release the registration
+// with UnregisterCallbacks after CodecDestroy.
+func RegisterPutSliceCallback(ctx *CodecCtx, fn PutSliceFunc) CodecErr {
+	if fn == nil {
+		return CodecInvalidParam
+	}
+	cbs := callbacksFor(ctx)
+	return cbs.set(func() { cbs.putSlice = fn }, func() CodecErr {
+		return CodecErr(C.vpx_codec_register_put_slice_cb((*C.vpx_codec_ctx_t)(unsafe.Pointer(ctx)),
+			C.vpx_codec_put_slice_cb_fn_t(C.goPutSliceCallback), cbs.priv))
+	})
+}
+
+// SetFrameBufferCallbacks makes the decoder ctx allocate its frame buffers
+// through get and release. Every context keeps its own callbacks. It must
+// be called before the first frame is decoded and is only supported by
+// codecs with
+// CodecCapExternalFrameBuffer. libvpx does not release every buffer when
+// the decoder is destroyed: the application frees whatever is left after
+// CodecDestroy. Release the registration with UnregisterCallbacks then.
+func SetFrameBufferCallbacks(ctx *CodecCtx, get GetFrameBufferFunc, release ReleaseFrameBufferFunc) CodecErr {
+	if get == nil || release == nil {
+		return CodecInvalidParam
+	}
+	cbs := callbacksFor(ctx)
+	return cbs.set(func() {
+		cbs.getFrameBuffer, cbs.releaseFrameBuffer = get, release
+	}, func() CodecErr {
+		return CodecErr(C.vpx_codec_set_frame_buffer_functions((*C.vpx_codec_ctx_t)(unsafe.Pointer(ctx)),
+			C.vpx_get_frame_buffer_cb_fn_t(C.goGetFrameBufferCallback),
+			C.vpx_release_frame_buffer_cb_fn_t(C.goReleaseFrameBufferCallback), cbs.priv))
+	})
+}
+
+// RegisterOutputPacketCallback registers fn with VP9ERegisterCxCallback to
+// receive the packets of the encoder ctx while CodecEncode runs, one per
+// spatial layer. The packets are then no longer returned by CodecGetCxData;
+// a nil fn restores that. Every context keeps its own callback. Release the
+// registration with UnregisterCallbacks after CodecDestroy.
+func RegisterOutputPacketCallback(ctx *CodecCtx, fn OutputPacketFunc) CodecErr {
+	var enable C.int
+	if fn != nil {
+		enable = 1
+	}
+	cbs := callbacksFor(ctx)
+	return cbs.set(func() { cbs.outputPacket = fn }, func() CodecErr {
+		return CodecErr(C.register_cx_callback((*C.vpx_codec_ctx_t)(unsafe.Pointer(ctx)), cbs.priv, enable))
+	})
+}
+
+// SetDecryptCallback registers fn with VPXDSetDecryptor to decrypt the
+// encrypted data the decoder ctx reads while CodecDecode runs; a nil fn
+// stops decryption. Every context keeps its own callback. Release the
+// registration with UnregisterCallbacks after CodecDestroy.
+func SetDecryptCallback(ctx *CodecCtx, fn DecryptFunc) CodecErr {
+	var enable C.int
+	if fn != nil {
+		enable = 1
+	}
+	cbs := callbacksFor(ctx)
+	return cbs.set(func() { cbs.decrypt = fn }, func() CodecErr {
+		return CodecErr(C.set_decryptor((*C.vpx_codec_ctx_t)(unsafe.Pointer(ctx)), cbs.priv, enable))
+	})
+}
+
+// CodecRegisterPutFrameCb registers cb to receive the frames decoded by
+// ctx, passing it userPriv. It is kept for the raw libvpx API and goes
+// through RegisterPutFrameCallback, so every context keeps its own
+// callback.
+//
+// Deprecated: Use RegisterPutFrameCallback.
+func CodecRegisterPutFrameCb(ctx *CodecCtx, cb CodecPutFrameCbFn, userPriv unsafe.Pointer) CodecErr {
+	if cb == nil {
+		return CodecInvalidParam
+	}
+	return RegisterPutFrameCallback(ctx, func(img *Image) {
+		cb(userPriv, img)
+	})
+}
+
+// CodecRegisterPutSliceCb registers cb to receive the parts of the frames
+// decoded by ctx, passing it userPriv. It is kept for the raw libvpx API
+// and goes through RegisterPutSliceCallback, so every context keeps its
+// own callback.
+//
+// Deprecated: Use RegisterPutSliceCallback.
+func CodecRegisterPutSliceCb(ctx *CodecCtx, cb CodecPutSliceCbFn, userPriv unsafe.Pointer) CodecErr {
+	if cb == nil {
+		return CodecInvalidParam
+	}
+	return RegisterPutSliceCallback(ctx, func(img *Image, valid, update *ImageRect) {
+		cb(userPriv, img, valid, update)
+	})
+}
+
+// CodecSetFrameBufferFunctions makes the decoder ctx allocate its frame
+// buffers through cbGet and cbRelease, passing them cbPriv. It is kept for
+// the raw libvpx API and goes through SetFrameBufferCallbacks, so every
+// context keeps its own callbacks.
+//
+// Deprecated: Use SetFrameBufferCallbacks.
+func CodecSetFrameBufferFunctions(ctx *CodecCtx, cbGet GetFrameBufferCbFn, cbRelease ReleaseFrameBufferCbFn, cbPriv unsafe.Pointer) CodecErr {
+	if cbGet == nil || cbRelease == nil {
+		return CodecInvalidParam
+	}
+	return SetFrameBufferCallbacks(ctx, func(minSize int, fb *CodecFrameBuffer) int {
+		return int(cbGet(cbPriv, uint(minSize), fb))
+	}, func(fb *CodecFrameBuffer) int {
+		return int(cbRelease(cbPriv, fb))
+	})
+}
+
+// UnregisterCallbacks drops the callbacks registered on ctx. Call it once
+// ctx has been destroyed and will invoke no more callbacks. It is a no-op if
+// nothing was registered.
+func UnregisterCallbacks(ctx *CodecCtx) {
+	callbacksMu.Lock()
+	cbs, ok := callbacks[ctx]
+	delete(callbacks, ctx)
+	callbacksMu.Unlock()
+	if !ok {
+		return
+	}
+	cbs.handle.Delete()
+	C.free(cbs.priv)
+}
+
+//export goPutFrameCallback
+func goPutFrameCallback(userPriv unsafe.Pointer, cimg *C.vpx_image_t) {
+	cbs := lookupCallbacks(userPriv)
+	cbs.mu.Lock()
+	fn := cbs.putFrame
+	cbs.mu.Unlock()
+	img := NewImageRef(unsafe.Pointer(cimg))
+	img.Deref()
+	fn(img)
+}
+
+//export goPutSliceCallback
+func goPutSliceCallback(userPriv unsafe.Pointer, cimg *C.vpx_image_t, cvalid, cupdate *C.vpx_image_rect_t) {
+	cbs := lookupCallbacks(userPriv)
+	cbs.mu.Lock()
+	fn := cbs.putSlice
+	cbs.mu.Unlock()
+	img := NewImageRef(unsafe.Pointer(cimg))
+	img.Deref()
+	valid := NewImageRectRef(unsafe.Pointer(cvalid))
+	valid.Deref()
+	update := NewImageRectRef(unsafe.Pointer(cupdate))
+	update.Deref()
+	fn(img, valid, update)
+}
+
+//export goGetFrameBufferCallback
+func goGetFrameBufferCallback(priv unsafe.Pointer, minSize C.size_t, cfb *C.vpx_codec_frame_buffer_t) C.int {
+	cbs := lookupCallbacks(priv)
+	cbs.mu.Lock()
+	fn := cbs.getFrameBuffer
+	cbs.mu.Unlock()
+	fb := &CodecFrameBuffer{}
+	if ret := fn(int(minSize), fb); ret != 0 {
+		return C.int(ret)
+	}
+	size := fb.Size
+	if size == 0 {
+		size = uint(len(fb.Data))
+	}
+	if size < uint(minSize) {
+		return -1
+	}
+	cfb.data = (*C.uint8_t)(unsafe.SliceData(fb.Data))
+	cfb.size = C.size_t(size)
+	cfb.priv = fb.Priv
+	return 0
+}
+
+//export goReleaseFrameBufferCallback
+func goReleaseFrameBufferCallback(priv unsafe.Pointer, cfb *C.vpx_codec_frame_buffer_t) C.int {
+	cbs := lookupCallbacks(priv)
+	cbs.mu.Lock()
+	fn := cbs.releaseFrameBuffer
+	cbs.mu.Unlock()
+	fb := &CodecFrameBuffer{
+		Data: unsafe.Slice((*byte)(cfb.data), int(cfb.size)),
+		Size: uint(cfb.size),
+		Priv: cfb.priv,
+	}
+	return C.int(fn(fb))
+}
+
+//export goOutputCxPktCallback
+func goOutputCxPktCallback(cpkt *C.vpx_codec_cx_pkt_t, userData unsafe.Pointer) {
+	cbs := lookupCallbacks(userData)
+	cbs.mu.Lock()
+	fn := cbs.outputPacket
+	cbs.mu.Unlock()
+	pkt := NewCodecCxPktRef(unsafe.Pointer(cpkt))
+	pkt.Deref()
+	fn(pkt)
+}
+
+//export goDecryptCallback
+func goDecryptCallback(state unsafe.Pointer, input, output *C.uchar, count C.int) {
+	cbs := lookupCallbacks(state)
+	cbs.mu.Lock()
+	fn := cbs.decrypt
+	cbs.mu.Unlock()
+	fn(unsafe.Slice((*byte)(input), int(count)), unsafe.Slice((*byte)(output), int(count)))
+}
@@ -0,0 +1,344 @@
+package vpx
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+// pinnedBuffers hands out Go-allocated frame buffers through
+// SetFrameBufferCallbacks, pinning each until libvpx releases it.
+type pinnedBuffers struct {
+	pinned map[*byte]pinnedBuffer
+	gets   int
+	// unknown counts releases of buffers that were not handed out.
+	unknown int
+}
+
+type pinnedBuffer struct {
+	pinner *runtime.Pinner
+	size   int
+}
+
+func newPinnedBuffers() *pinnedBuffers {
+	return &pinnedBuffers{pinned: make(map[*byte]pinnedBuffer)}
+}
+
+func (p *pinnedBuffers) get(minSize int, fb *CodecFrameBuffer) int {
+	buf := make([]byte, minSize)
+	pinner := new(runtime.Pinner)
+	pinner.Pin(&buf[0])
+	p.pinned[&buf[0]] = pinnedBuffer{pinner, minSize}
+	p.gets++
+	fb.Data = buf
+	return 0
+}
+
+func (p *pinnedBuffers) release(fb *CodecFrameBuffer) int {
+	if len(fb.Data) == 0 {
+		return 0
+	}
+	b, ok := p.pinned[&fb.Data[0]]
+	if !ok {
+		p.unknown++
+		return -1
+	}
+	b.pinner.Unpin()
+	delete(p.pinned, &fb.Data[0])
+	return 0
+}
+
+// free unpins the buffers libvpx did not release.
+func (p *pinnedBuffers) free() {
+	for start, b := range p.pinned {
+		b.pinner.Unpin()
+		delete(p.pinned, start)
+	}
+}
+
+// owns reports whether ptr lies in one of the buffers handed out and not
+// yet released.
+func (p *pinnedBuffers) owns(ptr *byte) bool {
+	for start, b := range p.pinned {
+		if offset := uintptr(unsafe.Pointer(ptr)) - uintptr(unsafe.Pointer(start)); offset < uintptr(b.size) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFrameBufferCallbacksConcurrent(t *testing.T) {
+	packets := encodeTestPackets(t, CodecVP9, 320, 240, 6)
+	var want []*Frame
+	ref, err := NewDecoder(CodecVP9, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	for _, p := range packets {
+		frames, err := ref.Decode(p.Data)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		for _, f := range frames {
+			want = append(want, f.Clone())
+		}
+	}
+	ref.Close()
+
+	const decoders = 8
+	var wg sync.WaitGroup
+	errs := make(chan string, decoders*len(want))
+	for n := 0; n < decoders; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dec, err := NewDecoder(CodecVP9, DecoderOptions{})
+			if err != nil {
+				errs <- err.Error()
+				return
+			}
+			buffers := newPinnedBuffers()
+			defer buffers.free()
+			defer dec.Close()
+			if err := Error(SetFrameBufferCallbacks(dec.Ctx(), buffers.get, buffers.release)); err != nil {
+				errs <- "SetFrameBufferCallbacks: " + err.Error()
+				return
+			}
+			var i int
+			for _, p := range packets {
+				frames, err := dec.Decode(p.Data)
+				if err != nil {
+					errs <- "Decode: " + err.Error()
+					return
+				}
+				for _, f := range frames {
+					if !buffers.owns(f.Image().Planes[PlaneY]) {
+						errs <- "frame is not in a buffer of its own decoder"
+					}
+					if !equalImages(f.Image(), want[i].Image()) {
+						errs <- "frame differs from the default decode"
+					}
+					i++
+				}
+			}
+			if buffers.gets == 0 {
+				errs <- "get frame buffer callback never called"
+			}
+			if buffers.unknown != 0 {
+				errs <- "released a buffer the decoder did not get"
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	callbacksMu.Lock()
+	defer callbacksMu.Unlock()
+	if len(callbacks) != 0 {
+		t.Errorf("%d callback registrations left after Close", len(callbacks))
+	}
+}
+
+func TestCodecSetFrameBufferFunctionsPerContext(t *testing.T) {
+	packets := encodeTestPackets(t, CodecVP9, 320, 240, 3)
+	var privs [2]int
+	var pinner runtime.Pinner
+	defer pinner.Unpin()
+	// Each decoder gets callbacks of its own; those of the first decoder
+	// must not serve the second.
+	for n := range privs {
+		buffers := newPinnedBuffers()
+		defer buffers.free()
+		privs[n] = n
+		pinner.Pin(&privs[n])
+		var wrongPriv int
+		get := func(priv unsafe.Pointer, minSize uint, fb *CodecFrameBuffer) int32 {
+			if *(*int)(priv) != n {
+				wrongPriv++
+			}
+			return int32(buffers.get(int(minSize), fb))
+		}
+		release := func(priv unsafe.Pointer, fb *CodecFrameBuffer) int32 {
+			return int32(buffers.release(fb))
+		}
+
+		dec, err := NewDecoder(CodecVP9, DecoderOptions{})
+		if err != nil {
+			t.Fatalf("NewDecoder failed: %v", err)
+		}
+		defer dec.Close()
+		if err := Error(CodecSetFrameBufferFunctions(dec.Ctx(), get, release, unsafe.Pointer(&privs[n]))); err != nil {
+			t.Fatalf("decoder %d: CodecSetFrameBufferFunctions failed: %v", n, err)
+		}
+		for _, p := range packets {
+			frames, err := dec.Decode(p.Data)
+			if err != nil || len(frames) != 1 {
+				t.Fatalf("decoder %d: Decode = %d frames, %v", n, len(frames), err)
+			}
+			if !buffers.owns(frames[0].Image().Planes[PlaneY]) {
+				t.Errorf("decoder %d: frame is not in a buffer of its own", n)
+			}
+		}
+		if buffers.gets == 0 || buffers.unknown != 0 || wrongPriv != 0 {
+			t.Errorf("decoder %d: %d gets, %d unknown releases, %d calls with another priv",
+				n, buffers.gets, buffers.unknown, wrongPriv)
+		}
+	}
+	if err := CodecSetFrameBufferFunctions(nil, nil, nil, nil); err != CodecInvalidParam {
+		t.Errorf("CodecSetFrameBufferFunctions(nil) = %v, want CodecInvalidParam", err)
+	}
+}
+
+func TestRegisterCallbacksUnsupported(t *testing.T) {
+	for _, codec := range []Codec{CodecVP8, CodecVP9} {
+		dec, err := NewDecoder(codec, DecoderOptions{})
+		if err != nil {
+			t.Fatalf("NewDecoder failed: %v", err)
+		}
+		caps := CodecGetCaps(DecoderFor(int(codec)))
+		if caps&CodecCapPutFrame == 0 {
+			if err := RegisterPutFrameCallback(dec.Ctx(), func(*Image) {}); err != CodecIncapable {
+				t.Errorf("%s: RegisterPutFrameCallback = %v, want CodecIncapable", codec, err)
+			}
+		}
+		if caps&CodecCapPutSlice == 0 {
+			if err := RegisterPutSliceCallback(dec.Ctx(), func(*Image, *ImageRect, *ImageRect) {}); err != CodecIncapable {
+				t.Errorf("%s: RegisterPutSliceCallback = %v, want CodecIncapable", codec, err)
+			}
+		}
+		if caps&CodecCapExternalFrameBuffer == 0 {
+			buffers := newPinnedBuffers()
+			defer buffers.free()
+			if err := SetFrameBufferCallbacks(dec.Ctx(), buffers.get, buffers.release); err != CodecIncapable {
+				t.Errorf("%s: SetFrameBufferCallbacks = %v, want CodecIncapable", codec, err)
+			}
+		}
+		if err := RegisterPutFrameCallback(dec.Ctx(), nil); err != CodecInvalidParam {
+			t.Errorf("%s: RegisterPutFrameCallback(nil) = %v, want CodecInvalidParam", codec, err)
+		}
+		dec.Close()
+	}
+}
+
+func TestEncoderPacketCallbackSVC(t *testing.T) {
+	newSVC := func() *Encoder {
+		return newSVCEncoder(t, NewSVCConfig(2, 2).
+			SetBitrate(0, 0, 100).SetBitrate(0, 1, 200).
+			SetBitrate(1, 0, 300).SetBitrate(1, 1, 600))
+	}
+	plain, cb := newSVC(), newSVC()
+	var got []Packet
+	var encoding bool
+	err := cb.SetPacketCallback(func(p Packet) {
+		if !encoding {
+			t.Error("packet delivered outside of Encode")
+		}
+		got = append(got, p)
+	})
+	if err != nil {
+		t.Fatalf("SetPacketCallback failed: %v", err)
+	}
+
+	img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+	defer ImageFree(img)
+	img.Deref()
+
+	for i := 0; i < 4; i++ {
+		fillTestPattern(img, i)
+		want, err := plain.Encode(img, CodecPts(i), 0)
+		if err != nil || len(want) != 1 {
+			t.Fatalf("Encode frame %d = %d packets, %v", i, len(want), err)
+		}
+		layers, err := SplitSuperframe(want[0].Data)
+		if err != nil {
+			t.Fatalf("SplitSuperframe failed: %v", err)
+		}
+
+		got = got[:0]
+		encoding = true
+		pkts, err := cb.Encode(img, CodecPts(i), 0)
+		encoding = false
+		if err != nil || len(pkts) != 0 {
+			t.Fatalf("callback Encode frame %d = %d packets, %v; want none returned", i, len(pkts), err)
+		}
+		if len(got) != len(layers) {
+			t.Fatalf("frame %d: callback got %d packets, want one per layer (%d)", i, len(got), len(layers))
+		}
+		for s, p := range got {
+			if !bytes.Equal(p.Data, layers[s]) {
+				t.Errorf("frame %d: spatial layer %d packet differs from the superframe", i, s)
+			}
+			if p.SpatialLayer != s || p.TemporalLayer != i%2 || p.Pts != CodecPts(i) {
+				t.Errorf("frame %d packet %d: layers %d/%d pts %d, want %d/%d pts %d",
+					i, s, p.SpatialLayer, p.TemporalLayer, p.Pts, s, i%2, i)
+			}
+		}
+	}
+
+	if err := cb.SetPacketCallback(nil); err != nil {
+		t.Fatalf("SetPacketCallback(nil) failed: %v", err)
+	}
+	got = got[:0]
+	pkts, err := cb.Encode(img, 4, 0)
+	if err != nil || len(pkts) != 1 || len(got) != 0 {
+		t.Errorf("after clearing the callback: Encode = %d packets, %v; callback got %d", len(pkts), err, len(got))
+	}
+}
+
+func TestEncoderPacketCallbackConcurrent(t *testing.T) {
+	const encoders = 4
+	var wg sync.WaitGroup
+	counts := make([]int, encoders)
+	for n := 0; n < encoders; n++ {
+		enc := newRealtimeEncoder(t, CodecVP9)
+		frames := n + 2
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := enc.SetPacketCallback(func(p Packet) {
+				if p.Pts != CodecPts(counts[n]) {
+					t.Errorf("encoder %d: got pts %d, want %d", n, p.Pts, counts[n])
+				}
+				counts[n]++
+			})
+			if err != nil {
+				t.Errorf("SetPacketCallback failed: %v", err)
+				return
+			}
+			img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+			defer ImageFree(img)
+			img.Deref()
+			for i := 0; i < frames; i++ {
+				fillTestPattern(img, i)
+				if _, err := enc.Encode(img, CodecPts(i), 0); err != nil {
+					t.Errorf("Encode failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for n, c := range counts {
+		if c != n+2 {
+			t.Errorf("encoder %d received %d packets, want %d", n, c, n+2)
+		}
+	}
+}
+
+func TestEncoderPacketCallbackErrors(t *testing.T) {
+	vp8 := newRealtimeEncoder(t, CodecVP8)
+	if err := vp8.SetPacketCallback(func(Packet) {}); !errors.Is(err, ErrCodecIncapable) {
+		t.Errorf("VP8 SetPacketCallback = %v, want ErrCodecIncapable", err)
+	}
+	vp9 := newRealtimeEncoder(t, CodecVP9)
+	vp9.Close()
+	if err := vp9.SetPacketCallback(func(Packet) {}); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("closed: SetPacketCallback = %v, want ErrCodecClosed", err)
+	}
+}
@@ -1,5 +1,7 @@
 package vpx
 
+import "fmt"
+
 func (fmt ImageFormat) String() string {
 	switch fmt {
 	case ImageFormatNone:
@@ -25,3 +27,22 @@ func (fmt ImageFormat) String() string {
 	}
 	return ""
 }
+
+func (c Codec) String() string {
+	switch c {
+	case CodecVP8:
+		return "VP8"
+	case CodecVP9:
+		return "VP9"
+	}
+	return ""
+}
+
+func (l Level) String() string {
+	switch l {
+	case Level1, Level11, Level2, Level21, Level3, Level31, Level4, Level41,
+		Level5, Level51, Level52, Level6, Level61, Level62:
+		return fmt.Sprintf("%d.%d", int(l)/10, int(l)%10)
+	}
+	return ""
+}
@@ -5,6 +5,7 @@ package vpx
 #cgo LDFLAGS: -L${SRCDIR}/../lib -lvpx
 #include <vpx/vpx_codec.h>
 #include <vpx/vp8cx.h>
+#include <vpx/vp8dx.h>
 
 static vpx_codec_err_t vpx_codec_control_int(vpx_codec_ctx_t *ctx, int ctrl_id, int value) {
 	return vpx_codec_control_(ctx, ctrl_id, value);
@@ -13,14 +14,45 @@ static vpx_codec_err_t vpx_codec_control_int(vpx_codec_ctx_t *ctx, int ctrl_id,
 static vpx_codec_err_t vpx_codec_control_uint(vpx_codec_ctx_t *ctx, int ctrl_id, unsigned int value) {
 	return vpx_codec_control_(ctx, ctrl_id, value);
 }
+
+static vpx_codec_err_t vpx_codec_control_ptr(vpx_codec_ctx_t *ctx, int ctrl_id, void *ptr) {
+	return vpx_codec_control_(ctx, ctrl_id, ptr);
+}
+
+static vpx_codec_err_t vpx_codec_control_scaling_mode(vpx_codec_ctx_t *ctx, int ctrl_id, int h_scaling_mode, int v_scaling_mode) {
+	vpx_scaling_mode_t mode = {(VPX_SCALING_MODE)h_scaling_mode, (VPX_SCALING_MODE)v_scaling_mode};
+	return vpx_codec_control_(ctx, ctrl_id, &mode);
+}
+
+static vpx_codec_err_t vpx_codec_control_active_map(vpx_codec_ctx_t *ctx, int ctrl_id, unsigned char *active_map, unsigned int rows, unsigned int cols) {
+	vpx_active_map_t map = {active_map, rows, cols};
+	return vpx_codec_control_(ctx, ctrl_id, &map);
+}
 */
 import "C"
 import "unsafe"
 
 const (
-	VP8ESetCPUUsed            = int(C.VP8E_SET_CPUUSED)
-	VP8ESetStaticThreshold    = int(C.VP8E_SET_STATIC_THRESHOLD)
-	VP8ESetMaxIntraBitratePct = int(C.VP8E_SET_MAX_INTRA_BITRATE_PCT)
+	VP8ESetCPUUsed             = int(C.VP8E_SET_CPUUSED)
+	VP8ESetEnableAutoAltRef    = int(C.VP8E_SET_ENABLEAUTOALTREF)
+	VP8ESetNoiseSensitivity    = int(C.VP8E_SET_NOISE_SENSITIVITY)
+	VP8ESetSharpness           = int(C.VP8E_SET_SHARPNESS)
+	VP8ESetStaticThreshold     = int(C.VP8E_SET_STATIC_THRESHOLD)
+	VP8ESetTokenPartitions     = int(C.VP8E_SET_TOKEN_PARTITIONS)
+	VP8ESetARNRMaxFrames       = int(C.VP8E_SET_ARNR_MAXFRAMES)
+	VP8ESetARNRStrength        = int(C.VP8E_SET_ARNR_STRENGTH)
+	VP8ESetARNRType            = int(C.VP8E_SET_ARNR_TYPE)
+	VP8ESetTuning              = int(C.VP8E_SET_TUNING)
+	VP8ESetCQLevel             = int(C.VP8E_SET_CQ_LEVEL)
+	VP8ESetMaxIntraBitratePct  = int(C.VP8E_SET_MAX_INTRA_BITRATE_PCT)
+	VP8ESetFrameFlags          = int(C.VP8E_SET_FRAME_FLAGS)
+	VP8ESetTemporalLayerID     = int(C.VP8E_SET_TEMPORAL_LAYER_ID)
+	VP8ESetScreenContentMode   = int(C.VP8E_SET_SCREEN_CONTENT_MODE)
+	VP8ESetGFCBRBoostPct       = int(C.VP8E_SET_GF_CBR_BOOST_PCT)
+	VP8ESetRTCExternalRatectrl = int(C.VP8E_SET_RTC_EXTERNAL_RATECTRL)
+	VP8ESetROIMap              = int(C.VP8E_SET_ROI_MAP)
+	VP8ESetActiveMap           = int(C.VP8E_SET_ACTIVEMAP)
+	VP8ESetScaleMode           = int(C.VP8E_SET_SCALEMODE)
 
 	VP9ESetTileColumns             = int(C.VP9E_SET_TILE_COLUMNS)
 	VP9ESetTileRows                = int(C.VP9E_SET_TILE_ROWS)
@@ -30,6 +62,138 @@ const (
 	VP9ESetGFCBRBoostPct           = int(C.VP9E_SET_GF_CBR_BOOST_PCT)
 	VP9ESetDisableOvershootMaxQCBR = int(C.VP9E_SET_DISABLE_OVERSHOOT_MAXQ_CBR)
 	VP9ESetDisableLoopFilter       = int(C.VP9E_SET_DISABLE_LOOPFILTER)
+	VP9ESetNoiseSensitivity        = int(C.VP9E_SET_NOISE_SENSITIVITY)
+	VP9ESetRTCExternalRatectrl     = int(C.VP9E_SET_RTC_EXTERNAL_RATECTRL)
+	VP9ESetLossless                = int(C.VP9E_SET_LOSSLESS)
+	VP9ESetAQMode                  = int(C.VP9E_SET_AQ_MODE)
+	VP9ESetTuneContent             = int(C.VP9E_SET_TUNE_CONTENT)
+	VP9ESetFramePeriodicBoost      = int(C.VP9E_SET_FRAME_PERIODIC_BOOST)
+	VP9ESetMinGFInterval           = int(C.VP9E_SET_MIN_GF_INTERVAL)
+	VP9ESetMaxGFInterval           = int(C.VP9E_SET_MAX_GF_INTERVAL)
+	VP9ESetTargetLevel             = int(C.VP9E_SET_TARGET_LEVEL)
+	VP9ESetDeltaQUV                = int(C.VP9E_SET_DELTA_Q_UV)
+	VP9ESetAltRefAQ                = int(C.VP9E_SET_ALT_REF_AQ)
+	VP9ESetKeyFrameFiltering       = int(C.VP9E_SET_KEY_FRAME_FILTERING)
+	VP9ESetPostencodeDrop          = int(C.VP9E_SET_POSTENCODE_DROP)
+	VP9ESetQuantizerOnePass        = int(C.VP9E_SET_QUANTIZER_ONE_PASS)
+	VP9ESetROIMap                  = int(C.VP9E_SET_ROI_MAP)
+	VP9ESetSVC                     = int(C.VP9E_SET_SVC)
+	VP9ESetSVCParameters           = int(C.VP9E_SET_SVC_PARAMETERS)
+	VP9ESetSVCLayerID              = int(C.VP9E_SET_SVC_LAYER_ID)
+	VP9ESetSVCRefFrameConfig       = int(C.VP9E_SET_SVC_REF_FRAME_CONFIG)
+	VP9ERegisterCxCallback         = int(C.VP9E_REGISTER_CX_CALLBACK)
+
+	VP8EGetLastQuantizer          = int(C.VP8E_GET_LAST_QUANTIZER)
+	VP8EGetLastQuantizer64        = int(C.VP8E_GET_LAST_QUANTIZER_64)
+	VP9EGetLevel                  = int(C.VP9E_GET_LEVEL)
+	VP9EGetLoopfilterLevel        = int(C.VP9E_GET_LOOPFILTER_LEVEL)
+	VP9EGetLastQuantizerSVCLayers = int(C.VP9E_GET_LAST_QUANTIZER_SVC_LAYERS)
+	VP9EGetActiveMap              = int(C.VP9E_GET_ACTIVEMAP)
+	VP9EGetSVCLayerID             = int(C.VP9E_GET_SVC_LAYER_ID)
+
+	VP8SetReference  = int(C.VP8_SET_REFERENCE)
+	VP8CopyReference = int(C.VP8_COPY_REFERENCE)
+	VP8SetPostproc   = int(C.VP8_SET_POSTPROC)
+	VP9GetReference  = int(C.VP9_GET_REFERENCE)
+
+	VP8DGetLastRefUpdates = int(C.VP8D_GET_LAST_REF_UPDATES)
+	VP8DGetFrameCorrupted = int(C.VP8D_GET_FRAME_CORRUPTED)
+	VP8DGetLastRefUsed    = int(C.VP8D_GET_LAST_REF_USED)
+	VPXDGetLastQuantizer  = int(C.VPXD_GET_LAST_QUANTIZER)
+	VP9DGetFrameSize      = int(C.VP9D_GET_FRAME_SIZE)
+	VP9DGetDisplaySize    = int(C.VP9D_GET_DISPLAY_SIZE)
+	VP9DGetBitDepth       = int(C.VP9D_GET_BIT_DEPTH)
+
+	VP9SetByteAlignment      = int(C.VP9_SET_BYTE_ALIGNMENT)
+	VP9InvertTileDecodeOrder = int(C.VP9_INVERT_TILE_DECODE_ORDER)
+	VP9SetSkipLoopFilter     = int(C.VP9_SET_SKIP_LOOP_FILTER)
+	VP9DSetRowMT             = int(C.VP9D_SET_ROW_MT)
+	VP9DSetLoopFilterOpt     = int(C.VP9D_SET_LOOP_FILTER_OPT)
+	VP9DecodeSVCSpatialLayer = int(C.VP9_DECODE_SVC_SPATIAL_LAYER)
+	VPXDSetDecryptor         = int(C.VPXD_SET_DECRYPTOR)
+)
+
+// TokenPartitions is the number of VP8 token partitions, as used by VP8ESetTokenPartitions.
+type TokenPartitions int
+
+const (
+	OneTokenPartition    TokenPartitions = C.VP8_ONE_TOKENPARTITION
+	TwoTokenPartitions   TokenPartitions = C.VP8_TWO_TOKENPARTITION
+	FourTokenPartitions  TokenPartitions = C.VP8_FOUR_TOKENPARTITION
+	EightTokenPartitions TokenPartitions = C.VP8_EIGHT_TOKENPARTITION
+)
+
+// Tuning is the visual tuning metric, as used by VP8ESetTuning.
+type Tuning int
+
+const (
+	TunePSNR Tuning = C.VP8_TUNE_PSNR
+	TuneSSIM Tuning = C.VP8_TUNE_SSIM
+)
+
+// ScreenContentMode is the VP8 screen content mode, as used by VP8ESetScreenContentMode.
+type ScreenContentMode int
+
+const (
+	ScreenContentOff        ScreenContentMode = 0
+	ScreenContentOn         ScreenContentMode = 1
+	ScreenContentAggressive ScreenContentMode = 2
+)
+
+// ScalingMode is the internal resize ratio along one axis, as used by
+// VP8ESetScaleMode.
+type ScalingMode int
+
+const (
+	ScalingNormal    ScalingMode = C.VP8E_NORMAL
+	ScalingFourFive  ScalingMode = C.VP8E_FOURFIVE
+	ScalingThreeFive ScalingMode = C.VP8E_THREEFIVE
+	ScalingOneTwo    ScalingMode = C.VP8E_ONETWO
+)
+
+// AQMode is the VP9 adaptive quantization mode, as used by VP9ESetAQMode.
+type AQMode int
+
+const (
+	AQOff           AQMode = 0
+	AQVariance      AQMode = 1
+	AQComplexity    AQMode = 2
+	AQCyclicRefresh AQMode = 3
+	AQEquator360    AQMode = 4
+)
+
+// TuneContent is the VP9 content type hint, as used by VP9ESetTuneContent.
+type TuneContent int
+
+const (
+	ContentDefault TuneContent = C.VP9E_CONTENT_DEFAULT
+	ContentScreen  TuneContent = C.VP9E_CONTENT_SCREEN
+	ContentFilm    TuneContent = C.VP9E_CONTENT_FILM
+)
+
+// Level is a VP9 bitstream level, as used by VP9ESetTargetLevel.
+// Named levels are encoded as major*10+minor.
+type Level int
+
+const (
+	// LevelStatsOnly keeps level statistics without targeting a level.
+	LevelStatsOnly Level = 0
+	Level1         Level = 10
+	Level11        Level = 11
+	Level2         Level = 20
+	Level21        Level = 21
+	Level3         Level = 30
+	Level31        Level = 31
+	Level4         Level = 40
+	Level41        Level = 41
+	Level5         Level = 50
+	Level51        Level = 51
+	Level52        Level = 52
+	Level6         Level = 60
+	Level61        Level = 61
+	Level62        Level = 62
+	// LevelOff disables level targeting. It is the encoder default.
+	LevelOff Level = 255
 )
 
 // CodecControlInt applies an int-valued encoder control to an initialized codec context.
@@ -54,3 +218,52 @@ func CodecControlUint(ctx *CodecCtx, ctrlID int, value uint32) CodecErr {
 	__v := (CodecErr)(__ret)
 	return __v
 }
+
+// CodecControlPtr applies a pointer-argument control, such as the VP8EGet*
+// and VP9EGet* read-back controls, to an initialized codec context.
+// ptr must point to memory of the type the control expects and must not
+// contain Go pointers.
+func CodecControlPtr(ctx *CodecCtx, ctrlID int, ptr unsafe.Pointer) CodecErr {
+	cctx, _ := (*C.vpx_codec_ctx_t)(unsafe.Pointer(ctx)), cgoAllocsUnknown
+	cctrlID, _ := (C.int)(ctrlID), cgoAllocsUnknown
+	__ret := C.vpx_codec_control_ptr(cctx, cctrlID, ptr)
+	__v := (CodecErr)(__ret)
+	return __v
+}
+
+// CodecControlIntPtr applies a control that writes a single int, such as
+// VP8EGetLastQuantizer, and returns the value written.
+func CodecControlIntPtr(ctx *CodecCtx, ctrlID int) (int, CodecErr) {
+	var value C.int
+	err := CodecControlPtr(ctx, ctrlID, unsafe.Pointer(&value))
+	return int(value), err
+}
+
+// CodecControlIntPair reads a control that fills an array of two ints, such
+// as the width and height reported by VP9DGetFrameSize.
+func CodecControlIntPair(ctx *CodecCtx, ctrlID int) (int, int, CodecErr) {
+	var value [2]C.int
+	err := CodecControlPtr(ctx, ctrlID, unsafe.Pointer(&value))
+	return int(value[0]), int(value[1]), err
+}
+
+// CodecControlActiveMap applies a control taking a vpx_active_map_t with one
+// byte per 16x16 macroblock, rows*cols bytes in total.
+func CodecControlActiveMap(ctx *CodecCtx, ctrlID int, activeMap []byte, rows, cols uint32) CodecErr {
+	cctx, _ := (*C.vpx_codec_ctx_t)(unsafe.Pointer(ctx)), cgoAllocsUnknown
+	cctrlID, _ := (C.int)(ctrlID), cgoAllocsUnknown
+	cmap, _ := (*C.uchar)(unsafe.SliceData(activeMap)), cgoAllocsUnknown
+	__ret := C.vpx_codec_control_active_map(cctx, cctrlID, cmap, C.uint(rows), C.uint(cols))
+	__v := (CodecErr)(__ret)
+	return __v
+}
+
+// CodecControlScalingMode applies a control taking a vpx_scaling_mode_t,
+// such as VP8ESetScaleMode.
+func CodecControlScalingMode(ctx *CodecCtx, ctrlID int, h, v ScalingMode) CodecErr {
+	cctx, _ := (*C.vpx_codec_ctx_t)(unsafe.Pointer(ctx)), cgoAllocsUnknown
+	cctrlID, _ := (C.int)(ctrlID), cgoAllocsUnknown
+	__ret := C.vpx_codec_control_scaling_mode(cctx, cctrlID, C.int(h), C.int(v))
+	__v := (CodecErr)(__ret)
+	return __v
+}
@@ -32,6 +32,18 @@ func TestVP9EncoderControls(t *testing.T) {
 	}
 }
 
+func TestCodecControlIntPtr(t *testing.T) {
+	ctx := newInitializedEncoder(t, EncoderIfaceVP8())
+	defer CodecDestroy(ctx)
+
+	if _, err := CodecControlIntPtr(ctx, VP8EGetLastQuantizer); err != CodecOk {
+		t.Fatalf("VP8EGetLastQuantizer failed: %v", Error(err))
+	}
+	if _, err := CodecControlIntPtr(ctx, VP9EGetLevel); err == CodecOk {
+		t.Fatal("expected VP9EGetLevel to fail on VP8")
+	}
+}
+
 func TestCodecControlInvalidID(t *testing.T) {
 	ctx := newInitializedEncoder(t, EncoderIfaceVP8())
 	defer CodecDestroy(ctx)
@@ -0,0 +1,414 @@
+package vpx
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// DecoderOptions configures a Decoder created by NewDecoder.
+type DecoderOptions struct {
+	// Threads is the maximum number of decoder threads. Zero keeps the default.
+	Threads uint32
+	// FrameThreading enables frame-based multi-threading (CodecUseFrameThreading).
+	FrameThreading bool
+	// Postproc enables post-processing (CodecUsePostproc).
+	Postproc bool
+	// ErrorConcealment enables error concealment (CodecUseErrorConcealment):
+	// the decoder fills in the parts of a frame lost with missing fragments
+	// and reports the frame as FrameInfo.Corrupted instead of failing. It
+	// needs CodecCapErrorConcealment, which VP8 only has when libvpx is
+	// built with --enable-error-concealment.
+	ErrorConcealment bool
+	// FrameBuffers, when set, supplies the frame buffers of a decoder with
+	// CodecCapExternalFrameBuffer, so that decoded frames can be kept with
+	// Frame.Retain instead of being copied.
+	FrameBuffers *FrameBufferPool
+	// InputFragments lets frames be passed in fragments, such as VP8
+	// partitions, with Decoder.DecodeFragment (CodecUseInputFragments).
+	// It needs CodecCapInputFragments.
+	InputFragments bool
+	// OnSlice, when set, receives the regions of each frame as they are
+	// decoded, before Decode returns. It needs CodecCapPutSlice, which
+	// neither the VP8 nor the VP9 decoder of the bundled libvpx has:
+	// NewDecoder then fails with ErrCodecIncapable.
+	OnSlice PutSliceFunc
+	// Decryptor, when set, decrypts the frames as they are decoded. See
+	// Decoder.SetDecryptor.
+	Decryptor Decryptor
+
+	// The options below are only supported by VP9.
+
+	// RowMT decodes rows of superblocks in parallel within each tile column.
+	// It needs Threads greater than one.
+	RowMT bool
+	// LoopFilterOpt runs the loop filter on each row as soon as it is decoded
+	// instead of after all tiles. It only applies together with RowMT.
+	LoopFilterOpt bool
+	// SkipLoopFilter disables the loop filter, trading visible artifacts for
+	// speed. See Decoder.SetSkipLoopFilter.
+	SkipLoopFilter bool
+	// InvertTileDecodeOrder decodes tile columns from right to left.
+	InvertTileDecodeOrder bool
+	// ByteAlignment aligns the planes of the frame buffers: zero for the
+	// legacy layout, or a power of two from 32 to 1024. See
+	// Decoder.SetByteAlignment.
+	ByteAlignment int
+	// SpatialLayers, when non-zero, decodes only the lowest SpatialLayers
+	// spatial layers of each SVC superframe, so that Decode returns frames
+	// of layer SpatialLayers-1. See Decoder.SetSpatialLayers.
+	SpatialLayers int
+}
+
+func (opts *DecoderOptions) flags() CodecFlags {
+	var flags CodecFlags
+	if opts.FrameThreading {
+		flags |= CodecUseFrameThreading
+	}
+	if opts.Postproc {
+		flags |= CodecUsePostproc
+	}
+	if opts.ErrorConcealment {
+		flags |= CodecUseErrorConcealment
+	}
+	if opts.InputFragments {
+		flags |= CodecUseInputFragments
+	}
+	return flags
+}
+
+// checkCaps rejects the options that need a capability the codec lacks.
+func (opts *DecoderOptions) checkCaps(codec Codec, caps CodecCaps) error {
+	required := []struct {
+		set  bool
+		cap  CodecCaps
+		name string
+	}{
+		{opts.FrameBuffers != nil, CodecCapExternalFrameBuffer, "external frame buffers"},
+		{opts.ErrorConcealment, CodecCapErrorConcealment, "error concealment"},
+		{opts.InputFragments, CodecCapInputFragments, "input fragments"},
+		{opts.OnSlice != nil, CodecCapPutSlice, "slice callbacks"},
+	}
+	for _, r := range required {
+		if r.set && caps&r.cap == 0 {
+			return fmt.Errorf("%w: %s decoder does not support %s", ErrCodecIncapable, codec, r.name)
+		}
+	}
+	return nil
+}
+
+// Decoder wraps an initialized decoder CodecCtx.
+// A Decoder is not safe for concurrent use.
+type Decoder struct {
+	codec Codec
+	ctx   *CodecCtx
+	// postproc records whether the decoder was created with Postproc.
+	postproc bool
+	// frameBuffers is the pool the decoder's frame buffers come from.
+	frameBuffers *FrameBufferPool
+	// inputFragments records whether the decoder was created with
+	// InputFragments, and fragments holds the C copies of the fragments
+	// of the frame being assembled.
+	inputFragments bool
+	fragments      []unsafe.Pointer
+	// decryptRegions locates the frame being decoded for the decryptor.
+	decryptRegions []decryptRegion
+	// width and height are the size of the last decoded frame.
+	width, height uint32
+	// gen is incremented by every call that invalidates borrowed frames.
+	gen uint64
+}
+
+// NewDecoder initializes a VP8 or VP9 decoder configured by opts.
+// The returned Decoder must be released with Close.
+func NewDecoder(codec Codec, opts DecoderOptions) (*Decoder, error) {
+	iface := DecoderFor(int(codec))
+	if iface == nil {
+		return nil, fmt.Errorf("%w: unsupported codec %d", ErrCodecInvalidParam, int(codec))
+	}
+
+	if err := opts.validateTuning(codec); err != nil {
+		return nil, err
+	}
+	if err := opts.checkCaps(codec, CodecGetCaps(iface)); err != nil {
+		return nil, err
+	}
+
+	var cfg *CodecDecCfg
+	if opts.Threads != 0 {
+		cfg = &CodecDecCfg{Threads: opts.Threads}
+		defer cfg.Free()
+	}
+
+	ctx := NewCodecCtx()
+	if err := codecError(ctx, "decoder init", CodecDecInitVer(ctx, iface, cfg, opts.flags(), DecoderABIVersion)); err != nil {
+		ctx.Free()
+		return nil, err
+	}
+	d := &Decoder{
+		codec:          codec,
+		ctx:            ctx,
+		postproc:       opts.Postproc,
+		inputFragments: opts.InputFragments,
+	}
+	if err := d.applyTuning(&opts); err != nil {
+		d.Close()
+		return nil, err
+	}
+	if opts.FrameBuffers != nil {
+		if err := opts.FrameBuffers.attach(ctx); err != nil {
+			d.Close()
+			return nil, err
+		}
+		d.frameBuffers = opts.FrameBuffers
+	}
+	if opts.Decryptor != nil {
+		if err := d.SetDecryptor(opts.Decryptor); err != nil {
+			d.Close()
+			return nil, err
+		}
+	}
+	if opts.OnSlice != nil {
+		if err := codecError(ctx, "register put slice", RegisterPutSliceCallback(ctx, opts.OnSlice)); err != nil {
+			d.Close()
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// Codec returns the codec this decoder consumes.
+func (d *Decoder) Codec() Codec {
+	return d.codec
+}
+
+// Ctx returns the underlying codec context for use with the low-level API.
+// It is nil once the decoder has been closed.
+func (d *Decoder) Ctx() *CodecCtx {
+	return d.ctx
+}
+
+// Decode decodes one compressed frame and returns the frames it produced.
+// The returned frames borrow decoder-owned memory and are only valid until
+// the next call to Decode, DecodeFragment, EndFrame, Flush or Close; use
+// Frame.Clone to keep them. Decoding empty data is equivalent to Flush.
+// With InputFragments, data is decoded as a single fragment.
+func (d *Decoder) Decode(data []byte) ([]*Frame, error) {
+	if d.ctx == nil {
+		return nil, ErrCodecClosed
+	}
+	if len(data) == 0 {
+		return d.Flush()
+	}
+	if d.inputFragments {
+		if err := d.DecodeFragment(data); err != nil {
+			return nil, err
+		}
+		return d.EndFrame()
+	}
+	d.gen++
+	cdata := unsafe.String(unsafe.SliceData(data), len(data))
+	d.addDecryptRegion(unsafe.Pointer(unsafe.SliceData(data)), len(data))
+	defer d.clearDecryptRegions()
+	if err := codecError(d.ctx, "decode", CodecDecode(d.ctx, cdata, uint32(len(data)), nil, 0)); err != nil {
+		return nil, err
+	}
+	return d.frames(), nil
+}
+
+// Flush signals the end of the stream and returns the frames still pending
+// inside the decoder. The frames follow the same ownership rules as Decode.
+// With InputFragments, it also decodes the fragments passed so far like
+// EndFrame.
+func (d *Decoder) Flush() ([]*Frame, error) {
+	if d.ctx == nil {
+		return nil, ErrCodecClosed
+	}
+	d.gen++
+	if d.inputFragments && len(d.fragments) == 0 {
+		// Fragment decoding never delays frames, and libvpx would take
+		// the call for an empty frame.
+		return nil, nil
+	}
+	defer d.freeFragments()
+	if err := codecError(d.ctx, "flush", CodecDecode(d.ctx, "", 0, nil, 0)); err != nil {
+		return nil, err
+	}
+	return d.frames(), nil
+}
+
+func (d *Decoder) frames() []*Frame {
+	var frames []*Frame
+	var iter CodecIter
+	for img := CodecGetFrame(d.ctx, &iter); img != nil; img = CodecGetFrame(d.ctx, &iter) {
+		img.Deref()
+		d.width, d.height = img.DW, img.DH
+		frames = append(frames, &Frame{
+			img:  img,
+			dec:  d,
+			gen:  d.gen,
+			info: d.frameInfo(img),
+		})
+	}
+	return frames
+}
+
+// Close destroys the decoder and frees its C resources. Borrowed frames
+// become invalid. It is safe to call Close more than once.
+func (d *Decoder) Close() error {
+	if d.ctx == nil {
+		return nil
+	}
+	d.gen++
+	err := codecError(d.ctx, "destroy", CodecDestroy(d.ctx))
+	if d.frameBuffers != nil {
+		d.frameBuffers.detach(d.ctx)
+	}
+	UnregisterCallbacks(d.ctx)
+	d.freeFragments()
+	d.ctx.Free()
+	d.ctx = nil
+	return err
+}
+
+// Frame is a decoded picture.
+//
+// A frame returned by Decoder.Decode or Decoder.Flush is a borrowed view of
+// an image owned by the decoder: it is invalidated by the next call on that
+// decoder. Clone returns a frame backed by Go memory that stays valid, and
+// Retain one that keeps the decoder's buffer when it comes from a
+// FrameBufferPool.
+type Frame struct {
+	img *Image
+	// dec is nil for frames that own their memory.
+	dec  *Decoder
+	gen  uint64
+	info FrameInfo
+	// buf is the pool buffer a retained frame holds a reference to.
+	buf *frameBuffer
+}
+
+// Valid reports whether the frame's image may still be accessed.
+func (f *Frame) Valid() bool {
+	return f != nil && f.img != nil && (f.dec == nil || f.dec.gen == f.gen)
+}
+
+// Borrowed reports whether the frame references decoder-owned memory.
+func (f *Frame) Borrowed() bool {
+	return f.dec != nil
+}
+
+// Image returns the frame's image, or nil if the frame is a borrowed view
+// that has been invalidated.
+func (f *Frame) Image() *Image {
+	if !f.Valid() {
+		return nil
+	}
+	return f.img
+}
+
+// Width returns the displayed width of the frame, or 0 if the frame is no
+// longer valid.
+func (f *Frame) Width() int {
+	if !f.Valid() {
+		return 0
+	}
+	return int(f.img.DW)
+}
+
+// Height returns the displayed height of the frame, or 0 if the frame is no
+// longer valid.
+func (f *Frame) Height() int {
+	if !f.Valid() {
+		return 0
+	}
+	return int(f.img.DH)
+}
+
+// Info returns what the decoder reported about the frame when it was
+// decoded. It stays available after a borrowed frame is invalidated.
+func (f *Frame) Info() FrameInfo {
+	return f.info
+}
+
+// Clone returns a copy of the frame whose planes are owned by Go.
+// It returns nil if the frame is no longer valid.
+func (f *Frame) Clone() *Frame {
+	if !f.Valid() {
+		return nil
+	}
+	return &Frame{img: cloneImage(f.img), info: f.info}
+}
+
+// cloneImage deep-copies the planes of src into a single Go buffer, keeping
+// the source strides so that the copy can be read like the original.
+func cloneImage(src *Image) *Image {
+	dst := imageHeader(src)
+
+	planes := 3
+	if src.Fmt&ImageFormatHasAlpha != 0 {
+		planes = 4
+	}
+	bytesPerSample := 1
+	if src.Fmt&ImageFormatHighbitdepth != 0 {
+		bytesPerSample = 2
+	}
+
+	var offsets [4]int
+	var size int
+	for p := 0; p < planes; p++ {
+		offsets[p] = size
+		size += int(src.Stride[p]) * planeRows(src, p)
+	}
+	dst.ImgData = make([]byte, size)
+
+	for p := 0; p < planes; p++ {
+		stride := int(src.Stride[p])
+		rows := planeRows(src, p)
+		if src.Planes[p] == nil || rows == 0 {
+			continue
+		}
+		rowBytes := planeCols(src, p) * bytesPerSample
+		srcPlane := unsafe.Slice(src.Planes[p], stride*(rows-1)+rowBytes)
+		dstPlane := dst.ImgData[offsets[p] : offsets[p]+stride*rows]
+		for row := 0; row < rows; row++ {
+			copy(dstPlane[row*stride:row*stride+rowBytes], srcPlane[row*stride:])
+		}
+		dst.Planes[p] = &dstPlane[0]
+	}
+	return dst
+}
+
+// imageHeader returns a Go-owned Image with the format, size and strides of
+// src but no planes.
+func imageHeader(src *Image) *Image {
+	return &Image{
+		Fmt:          src.Fmt,
+		Cs:           src.Cs,
+		Range:        src.Range,
+		W:            src.W,
+		H:            src.H,
+		BitDepth:     src.BitDepth,
+		DW:           src.DW,
+		DH:           src.DH,
+		RW:           src.RW,
+		RH:           src.RH,
+		XChromaShift: src.XChromaShift,
+		YChromaShift: src.YChromaShift,
+		Stride:       src.Stride,
+		Bps:          src.Bps,
+	}
+}
+
+func planeRows(img *Image, plane int) int {
+	if plane == PlaneU || plane == PlaneV {
+		return int((img.DH + img.YChromaShift) >> img.YChromaShift)
+	}
+	return int(img.DH)
+}
+
+func planeCols(img *Image, plane int) int {
+	if plane == PlaneU || plane == PlaneV {
+		return int((img.DW + img.XChromaShift) >> img.XChromaShift)
+	}
+	return int(img.DW)
+}
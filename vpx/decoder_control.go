@@ -0,0 +1,158 @@
+package vpx
+
+import "fmt"
+
+// requireCodec returns ErrCodecIncapable unless the decoder consumes codec.
+func (d *Decoder) requireCodec(codec Codec, op string) error {
+	if d.codec != codec {
+		return fmt.Errorf("%w: %s is only supported by %s", ErrCodecIncapable, op, codec)
+	}
+	return nil
+}
+
+// controlIntPtr reads back an int-valued control.
+func (d *Decoder) controlIntPtr(op string, ctrlID int) (int, error) {
+	if d.ctx == nil {
+		return 0, ErrCodecClosed
+	}
+	value, err := CodecControlIntPtr(d.ctx, ctrlID)
+	if err := codecError(d.ctx, op, err); err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+// controlIntPair reads back a control that fills two ints.
+func (d *Decoder) controlIntPair(op string, ctrlID int) (int, int, error) {
+	if d.ctx == nil {
+		return 0, 0, ErrCodecClosed
+	}
+	a, b, err := CodecControlIntPair(d.ctx, ctrlID)
+	if err := codecError(d.ctx, op, err); err != nil {
+		return 0, 0, err
+	}
+	return a, b, nil
+}
+
+// FrameCorrupted reports whether the last decoded frame, or a reference it
+// depends on, is corrupt.
+func (d *Decoder) FrameCorrupted() (bool, error) {
+	corrupted, err := d.controlIntPtr("get frame corrupted", VP8DGetFrameCorrupted)
+	return corrupted != 0, err
+}
+
+// LastRefUpdates returns the VP8 reference frames refreshed by the last
+// decoded frame.
+func (d *Decoder) LastRefUpdates() (RefFrameType, error) {
+	if err := d.requireCodec(CodecVP8, "last ref updates"); err != nil {
+		return 0, err
+	}
+	refs, err := d.controlIntPtr("get last ref updates", VP8DGetLastRefUpdates)
+	return RefFrameType(refs), err
+}
+
+// LastBufferUpdates returns the VP9 reference buffers refreshed by the last
+// decoded frame, with bit i set for buffer i as addressed by ReferenceBuffer.
+func (d *Decoder) LastBufferUpdates() (uint8, error) {
+	if err := d.requireCodec(CodecVP9, "last buffer updates"); err != nil {
+		return 0, err
+	}
+	buffers, err := d.controlIntPtr("get last ref updates", VP8DGetLastRefUpdates)
+	return uint8(buffers), err
+}
+
+// LastRefUsed returns the VP8 reference frames the last decoded frame
+// predicted from. It is zero for keyframes.
+func (d *Decoder) LastRefUsed() (RefFrameType, error) {
+	if err := d.requireCodec(CodecVP8, "last ref used"); err != nil {
+		return 0, err
+	}
+	refs, err := d.controlIntPtr("get last ref used", VP8DGetLastRefUsed)
+	return RefFrameType(refs), err
+}
+
+// LastQuantizer returns the base quantizer of the last decoded frame, on
+// libvpx's internal 0..255 (VP9) or 0..127 (VP8) scale.
+func (d *Decoder) LastQuantizer() (int, error) {
+	return d.controlIntPtr("get last quantizer", VPXDGetLastQuantizer)
+}
+
+// FrameSize returns the coded size of the last decoded VP9 frame.
+func (d *Decoder) FrameSize() (width, height int, err error) {
+	if err := d.requireCodec(CodecVP9, "frame size"); err != nil {
+		return 0, 0, err
+	}
+	return d.controlIntPair("get frame size", VP9DGetFrameSize)
+}
+
+// DisplaySize returns the display size signaled by the last decoded VP9
+// frame, which may differ from its coded size.
+func (d *Decoder) DisplaySize() (width, height int, err error) {
+	if err := d.requireCodec(CodecVP9, "display size"); err != nil {
+		return 0, 0, err
+	}
+	return d.controlIntPair("get display size", VP9DGetDisplaySize)
+}
+
+// BitDepth returns the bit depth of the VP9 stream being decoded.
+func (d *Decoder) BitDepth() (int, error) {
+	if err := d.requireCodec(CodecVP9, "bit depth"); err != nil {
+		return 0, err
+	}
+	return d.controlIntPtr("get bit depth", VP9DGetBitDepth)
+}
+
+// FrameInfo describes a decoded frame as reported by the decoder controls.
+type FrameInfo struct {
+	// Corrupted is set when the frame or a reference it depends on is
+	// corrupt, as when data was lost since the last keyframe or the frame
+	// was concealed.
+	Corrupted bool
+	// RefsUpdated and RefsUsed are the VP8 reference frames the frame
+	// refreshed and predicted from. They are zero for VP9.
+	RefsUpdated RefFrameType
+	RefsUsed    RefFrameType
+	// BuffersUpdated has bit i set for each VP9 reference buffer the frame
+	// refreshed. It is zero for VP8.
+	BuffersUpdated uint8
+	// Quantizer is the base quantizer, on the 0..255 (VP9) or 0..127 (VP8)
+	// scale.
+	Quantizer int
+	// Width and Height are the coded size of the frame.
+	Width, Height int
+	// DisplayWidth and DisplayHeight are the size the frame should be shown
+	// at. VP8 does not signal it separately from the coded size.
+	DisplayWidth, DisplayHeight int
+	BitDepth                    int
+}
+
+// frameInfo gathers the FrameInfo of the last decoded frame, whose image is
+// img. Controls the codec does not support leave their fields zero.
+func (d *Decoder) frameInfo(img *Image) FrameInfo {
+	info := FrameInfo{
+		Width:         int(img.DW),
+		Height:        int(img.DH),
+		DisplayWidth:  int(img.DW),
+		DisplayHeight: int(img.DH),
+		BitDepth:      int(img.BitDepth),
+	}
+	info.Corrupted, _ = d.FrameCorrupted()
+	info.Quantizer, _ = d.LastQuantizer()
+	switch d.codec {
+	case CodecVP8:
+		info.RefsUpdated, _ = d.LastRefUpdates()
+		info.RefsUsed, _ = d.LastRefUsed()
+	case CodecVP9:
+		info.BuffersUpdated, _ = d.LastBufferUpdates()
+		if w, h, err := d.FrameSize(); err == nil {
+			info.Width, info.Height = w, h
+		}
+		if w, h, err := d.DisplaySize(); err == nil {
+			info.DisplayWidth, info.DisplayHeight = w, h
+		}
+		if depth, err := d.BitDepth(); err == nil {
+			info.BitDepth = depth
+		}
+	}
+	return info
+}
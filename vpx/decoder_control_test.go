@@ -0,0 +1,173 @@
+package vpx
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecoderFrameInfo(t *testing.T) {
+	for _, codec := range []Codec{CodecVP8, CodecVP9} {
+		t.Run(codec.String(), func(t *testing.T) {
+			const width, height = 324, 244
+			enc, err := NewEncoder(codec, EncoderOptions{
+				Width:    width,
+				Height:   height,
+				Deadline: DlRealtime,
+				Configure: func(cfg *CodecEncCfg) {
+					cfg.GLagInFrames = 0
+				},
+			})
+			if err != nil {
+				t.Fatalf("NewEncoder failed: %v", err)
+			}
+			defer enc.Close()
+			dec, err := NewDecoder(codec, DecoderOptions{})
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			defer dec.Close()
+
+			img := ImageAlloc(nil, ImageFormatI420, width, height, 1)
+			defer ImageFree(img)
+			img.Deref()
+
+			flags := []EncFrameFlags{
+				0,
+				EncFrameFlags(0).ReferenceOnly(RefLast).UpdateOnly(RefLast),
+				EncFrameFlags(0).ReferenceOnly(RefLast).UpdateOnly(RefGolden).ForceUpdate(RefGolden),
+			}
+			var infos []FrameInfo
+			for i, f := range flags {
+				fillTestPatternForSize(img, i, width, height)
+				pkts, err := enc.Encode(img, CodecPts(i), f)
+				if err != nil || len(pkts) != 1 {
+					t.Fatalf("Encode frame %d = %d packets, %v", i, len(pkts), err)
+				}
+				q, err := enc.LastQuantizer()
+				if err != nil {
+					t.Fatalf("Encoder.LastQuantizer failed: %v", err)
+				}
+				frames, err := dec.Decode(pkts[0].Data)
+				if err != nil || len(frames) != 1 {
+					t.Fatalf("Decode frame %d = %d frames, %v", i, len(frames), err)
+				}
+				info := frames[0].Info()
+				if info.Quantizer != q {
+					t.Errorf("frame %d: quantizer = %d, encoder used %d", i, info.Quantizer, q)
+				}
+				if info.Corrupted {
+					t.Errorf("frame %d is corrupted", i)
+				}
+				if info.Width != width || info.Height != height || info.DisplayWidth != width || info.DisplayHeight != height {
+					t.Errorf("frame %d: size %dx%d display %dx%d, want %dx%d", i, info.Width, info.Height, info.DisplayWidth, info.DisplayHeight, width, height)
+				}
+				if info.BitDepth != 8 {
+					t.Errorf("frame %d: bit depth = %d, want 8", i, info.BitDepth)
+				}
+				if clone := frames[0].Clone(); clone.Info() != info {
+					t.Errorf("frame %d: clone info = %+v, want %+v", i, clone.Info(), info)
+				}
+				infos = append(infos, info)
+			}
+
+			switch codec {
+			case CodecVP8:
+				if infos[0].RefsUpdated != RefAll || infos[0].RefsUsed != 0 {
+					t.Errorf("keyframe updated %#x used %#x, want all and none", infos[0].RefsUpdated, infos[0].RefsUsed)
+				}
+				if infos[1].RefsUpdated != RefLast || infos[1].RefsUsed&^RefLast != 0 {
+					t.Errorf("frame 1 updated %#x used %#x, want last only", infos[1].RefsUpdated, infos[1].RefsUsed)
+				}
+				if infos[2].RefsUpdated != RefGolden {
+					t.Errorf("frame 2 updated %#x, want golden", infos[2].RefsUpdated)
+				}
+			case CodecVP9:
+				if infos[0].BuffersUpdated != 0xff {
+					t.Errorf("keyframe updated buffers %#x, want 0xff", infos[0].BuffersUpdated)
+				}
+				for i, info := range infos[1:] {
+					if n := bitCount(info.BuffersUpdated); n != 1 {
+						t.Errorf("frame %d updated %d buffers (%#x), want 1", i+1, n, info.BuffersUpdated)
+					}
+				}
+				if infos[1].BuffersUpdated == infos[2].BuffersUpdated {
+					t.Errorf("last and golden updates both refreshed buffers %#x", infos[1].BuffersUpdated)
+				}
+			}
+		})
+	}
+}
+
+func bitCount(v uint8) int {
+	var n int
+	for ; v != 0; v &= v - 1 {
+		n++
+	}
+	return n
+}
+
+func TestDecoderControlCodecs(t *testing.T) {
+	vp8, err := NewDecoder(CodecVP8, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer vp8.Close()
+	vp9, err := NewDecoder(CodecVP9, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer vp9.Close()
+
+	vp9Only := []func() error{
+		func() error { _, err := vp8.LastBufferUpdates(); return err },
+		func() error { _, _, err := vp8.FrameSize(); return err },
+		func() error { _, _, err := vp8.DisplaySize(); return err },
+		func() error { _, err := vp8.BitDepth(); return err },
+	}
+	for i, get := range vp9Only {
+		if err := get(); !errors.Is(err, ErrCodecIncapable) {
+			t.Errorf("VP8 getter %d = %v, want ErrCodecIncapable", i, err)
+		}
+	}
+	vp8Only := []func() error{
+		func() error { _, err := vp9.LastRefUpdates(); return err },
+		func() error { _, err := vp9.LastRefUsed(); return err },
+	}
+	for i, get := range vp8Only {
+		if err := get(); !errors.Is(err, ErrCodecIncapable) {
+			t.Errorf("VP9 getter %d = %v, want ErrCodecIncapable", i, err)
+		}
+	}
+
+	vp8.Close()
+	if _, err := vp8.LastQuantizer(); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("closed: LastQuantizer = %v, want ErrCodecClosed", err)
+	}
+	vp9.Close()
+	if _, _, err := vp9.FrameSize(); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("closed: FrameSize = %v, want ErrCodecClosed", err)
+	}
+}
+
+func TestFrameInfoAfterInvalidation(t *testing.T) {
+	packets := encodeTestPackets(t, CodecVP8, 320, 240, 2)
+	dec, err := NewDecoder(CodecVP8, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer dec.Close()
+
+	frames, err := dec.Decode(packets[0].Data)
+	if err != nil || len(frames) != 1 {
+		t.Fatalf("Decode = %d frames, %v", len(frames), err)
+	}
+	if _, err := dec.Decode(packets[1].Data); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if frames[0].Valid() {
+		t.Fatal("frame still valid after the next Decode")
+	}
+	if info := frames[0].Info(); info.RefsUpdated != RefAll || info.Width != 320 {
+		t.Errorf("Info after invalidation = %+v, want the keyframe's info", info)
+	}
+}
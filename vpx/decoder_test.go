@@ -0,0 +1,179 @@
+package vpx
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"unsafe"
+)
+
+func TestDecoderDecode(t *testing.T) {
+	for _, codec := range []Codec{CodecVP8, CodecVP9} {
+		t.Run(codec.String(), func(t *testing.T) {
+			const (
+				width      = 320
+				height     = 240
+				frameCount = 5
+			)
+
+			packets := encodeTestPackets(t, codec, width, height, frameCount)
+
+			dec, err := NewDecoder(codec, DecoderOptions{Threads: 2})
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			defer dec.Close()
+
+			var decoded int
+			for i, pkt := range packets {
+				frames, err := dec.Decode(pkt.Data)
+				if err != nil {
+					t.Fatalf("Decode packet %d failed: %v", i, err)
+				}
+				for _, frame := range frames {
+					if frame.Width() != width || frame.Height() != height {
+						t.Errorf("frame size = %dx%d, want %dx%d", frame.Width(), frame.Height(), width, height)
+					}
+					if !frame.Borrowed() {
+						t.Error("decoded frame is not borrowed")
+					}
+					decoded++
+				}
+			}
+			frames, err := dec.Flush()
+			if err != nil {
+				t.Fatalf("Flush failed: %v", err)
+			}
+			decoded += len(frames)
+
+			if decoded != frameCount {
+				t.Errorf("decoded %d frames, want %d", decoded, frameCount)
+			}
+		})
+	}
+}
+
+func TestDecoderBorrowedFrameInvalidation(t *testing.T) {
+	packets := encodeTestPackets(t, CodecVP8, 320, 240, 2)
+
+	dec, err := NewDecoder(CodecVP8, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer dec.Close()
+
+	frames, err := dec.Decode(packets[0].Data)
+	if err != nil || len(frames) != 1 {
+		t.Fatalf("Decode = %d frames, %v; want 1 frame", len(frames), err)
+	}
+	borrowed := frames[0]
+	cloned := borrowed.Clone()
+	want := visiblePlane(borrowed.Image(), PlaneY)
+
+	if _, err := dec.Decode(packets[1].Data); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	if borrowed.Valid() || borrowed.Image() != nil {
+		t.Error("borrowed frame is still valid after the next Decode")
+	}
+	if borrowed.Clone() != nil {
+		t.Error("Clone of an invalidated frame is not nil")
+	}
+	if !cloned.Valid() || cloned.Borrowed() {
+		t.Fatal("cloned frame is not an owned, valid frame")
+	}
+	if !bytes.Equal(visiblePlane(cloned.Image(), PlaneY), want) {
+		t.Error("cloned Y plane differs from the original")
+	}
+	if rgba := cloned.Image().ImageRGBA(); rgba.Bounds().Dx() != 320 || rgba.Bounds().Dy() != 240 {
+		t.Errorf("cloned RGBA bounds = %v", rgba.Bounds())
+	}
+}
+
+func TestDecoderCloneI444(t *testing.T) {
+	src := ImageAlloc(nil, ImageFormatI444, 64, 48, 1)
+	defer ImageFree(src)
+	src.Deref()
+
+	for p := PlaneY; p <= PlaneV; p++ {
+		plane := unsafe.Slice(src.Planes[p], int(src.Stride[p])*48)
+		for i := range plane {
+			plane[i] = byte(i + p)
+		}
+	}
+
+	dst := cloneImage(src)
+	for p := PlaneY; p <= PlaneV; p++ {
+		if planeRows(dst, p) != 48 || planeCols(dst, p) != 64 {
+			t.Fatalf("plane %d size = %dx%d, want 64x48", p, planeCols(dst, p), planeRows(dst, p))
+		}
+		if !bytes.Equal(visiblePlane(dst, p), visiblePlane(src, p)) {
+			t.Errorf("cloned plane %d differs from the source", p)
+		}
+	}
+}
+
+func TestDecoderCorruptData(t *testing.T) {
+	dec, err := NewDecoder(CodecVP9, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer dec.Close()
+
+	_, err = dec.Decode([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	if err == nil {
+		t.Fatal("expected Decode of garbage to fail")
+	}
+	t.Logf("decode error: %v", err)
+}
+
+func TestDecoderPostprocOption(t *testing.T) {
+	for _, codec := range []Codec{CodecVP8, CodecVP9} {
+		t.Run(codec.String(), func(t *testing.T) {
+			dec, err := NewDecoder(codec, DecoderOptions{Postproc: true})
+			if CodecGetCaps(DecoderFor(int(codec)))&CodecCapPostproc == 0 {
+				if !errors.Is(err, ErrCodecIncapable) {
+					t.Fatalf("NewDecoder error = %v, want ErrCodecIncapable", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			dec.Close()
+		})
+	}
+}
+
+func TestDecoderClose(t *testing.T) {
+	dec, err := NewDecoder(CodecVP8, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	if err := dec.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := dec.Close(); err != nil {
+		t.Fatalf("second Close failed: %v", err)
+	}
+	if _, err := dec.Decode([]byte{0}); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("Decode after Close = %v, want ErrCodecClosed", err)
+	}
+	if _, err := dec.Flush(); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("Flush after Close = %v, want ErrCodecClosed", err)
+	}
+}
+
+// visiblePlane returns a copy of the displayed samples of an 8-bit plane,
+// without the stride padding.
+func visiblePlane(img *Image, plane int) []byte {
+	rows, cols := planeRows(img, plane), planeCols(img, plane)
+	stride := int(img.Stride[plane])
+	src := unsafe.Slice(img.Planes[plane], stride*rows)
+	out := make([]byte, 0, rows*cols)
+	for row := 0; row < rows; row++ {
+		out = append(out, src[row*stride:row*stride+cols]...)
+	}
+	return out
+}
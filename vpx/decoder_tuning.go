@@ -0,0 +1,118 @@
+package vpx
+
+import "fmt"
+
+// tuned reports whether any of the VP9-only decoder options is set.
+func (opts *DecoderOptions) tuned() bool {
+	return opts.RowMT || opts.LoopFilterOpt || opts.SkipLoopFilter ||
+		opts.InvertTileDecodeOrder || opts.ByteAlignment != 0 || opts.SpatialLayers != 0
+}
+
+func (opts *DecoderOptions) validateTuning(codec Codec) error {
+	if !opts.tuned() {
+		return nil
+	}
+	if codec != CodecVP9 {
+		return fmt.Errorf("%w: decoder tuning is only supported by %s", ErrCodecIncapable, CodecVP9)
+	}
+	if err := checkRange("spatial layers", opts.SpatialLayers, 0, SsMaxLayers); err != nil {
+		return err
+	}
+	return checkByteAlignment(opts.ByteAlignment)
+}
+
+func checkByteAlignment(align int) error {
+	if align != 0 && (align < 32 || align > 1024 || align&(align-1) != 0) {
+		return fmt.Errorf("%w: byte alignment %d is not 0 or a power of two in [32, 1024]", ErrCodecInvalidParam, align)
+	}
+	return nil
+}
+
+// applyTuning sets the VP9 decoder controls requested by opts. Row MT, the
+// loop filter optimization and the tile order are read when the decoder
+// sees its first frame, so they must be applied before any Decode.
+func (d *Decoder) applyTuning(opts *DecoderOptions) error {
+	if !opts.tuned() {
+		return nil
+	}
+	controls := []struct {
+		op     string
+		ctrlID int
+		value  bool
+	}{
+		{"set row mt", VP9DSetRowMT, opts.RowMT},
+		{"set loop filter opt", VP9DSetLoopFilterOpt, opts.LoopFilterOpt},
+		{"set skip loop filter", VP9SetSkipLoopFilter, opts.SkipLoopFilter},
+		{"invert tile decode order", VP9InvertTileDecodeOrder, opts.InvertTileDecodeOrder},
+	}
+	for _, c := range controls {
+		if !c.value {
+			continue
+		}
+		if err := d.controlInt(c.op, c.ctrlID, 1); err != nil {
+			return err
+		}
+	}
+	if opts.SpatialLayers != 0 {
+		if err := d.SetSpatialLayers(opts.SpatialLayers); err != nil {
+			return err
+		}
+	}
+	if opts.ByteAlignment != 0 {
+		return d.controlInt("set byte alignment", VP9SetByteAlignment, opts.ByteAlignment)
+	}
+	return nil
+}
+
+// controlInt applies an int-valued control.
+func (d *Decoder) controlInt(op string, ctrlID int, value int) error {
+	if d.ctx == nil {
+		return ErrCodecClosed
+	}
+	return codecError(d.ctx, op, CodecControlInt(d.ctx, ctrlID, value))
+}
+
+// SetSkipLoopFilter enables or disables the VP9 loop filter for the frames
+// decoded from now on. Skipping it is faster but lets artifacts accumulate
+// until the next keyframe.
+func (d *Decoder) SetSkipLoopFilter(skip bool) error {
+	if err := d.requireCodec(CodecVP9, "skip loop filter"); err != nil {
+		return err
+	}
+	var value int
+	if skip {
+		value = 1
+	}
+	return d.controlInt("set skip loop filter", VP9SetSkipLoopFilter, value)
+}
+
+// SetByteAlignment sets the plane alignment of the VP9 frame buffers
+// allocated from now on: zero for the legacy layout, or a power of two from
+// 32 to 1024.
+func (d *Decoder) SetByteAlignment(align int) error {
+	if err := d.requireCodec(CodecVP9, "byte alignment"); err != nil {
+		return err
+	}
+	if err := checkByteAlignment(align); err != nil {
+		return err
+	}
+	return d.controlInt("set byte alignment", VP9SetByteAlignment, align)
+}
+
+// SetSpatialLayers limits decoding of the following VP9 SVC superframes to
+// their lowest layers spatial layers, 1..SsMaxLayers, skipping the work of
+// the layers above. Zero decodes every layer again. Frames of a layer that
+// was skipped cannot be predicted from later, so only raise the limit at a
+// point the encoder marks as a switch-up, such as a keyframe.
+func (d *Decoder) SetSpatialLayers(layers int) error {
+	if err := d.requireCodec(CodecVP9, "spatial layers"); err != nil {
+		return err
+	}
+	if err := checkRange("spatial layers", layers, 0, SsMaxLayers); err != nil {
+		return err
+	}
+	if layers == 0 {
+		layers = SsMaxLayers
+	}
+	return d.controlInt("decode svc spatial layer", VP9DecodeSVCSpatialLayer, layers-1)
+}
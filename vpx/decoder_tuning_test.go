@@ -0,0 +1,204 @@
+package vpx
+
+import (
+	"errors"
+	"testing"
+	"unsafe"
+)
+
+// encodeTiledVP9 encodes count test pattern frames at bitrate kbps as a VP9
+// stream with 1<<log2Tiles tile columns, so that the tile and row threading
+// paths of the decoder run.
+func encodeTiledVP9(tb testing.TB, width, height, bitrate uint32, log2Tiles, count int) [][]byte {
+	tb.Helper()
+	enc, err := NewEncoder(CodecVP9, EncoderOptions{
+		Width:    width,
+		Height:   height,
+		Bitrate:  bitrate,
+		Deadline: DlRealtime,
+		Configure: func(cfg *CodecEncCfg) {
+			cfg.GLagInFrames = 0
+		},
+	})
+	if err != nil {
+		tb.Fatalf("NewEncoder failed: %v", err)
+	}
+	defer enc.Close()
+	if err := Error(CodecControlInt(enc.Ctx(), VP9ESetTileColumns, log2Tiles)); err != nil {
+		tb.Fatalf("set tile columns failed: %v", err)
+	}
+
+	img := ImageAlloc(nil, ImageFormatI420, width, height, 1)
+	defer ImageFree(img)
+	img.Deref()
+
+	var stream [][]byte
+	for i := 0; i < count; i++ {
+		fillTestPatternForSize(img, i, width, height)
+		pkts, err := enc.Encode(img, CodecPts(i), 0)
+		if err != nil {
+			tb.Fatalf("Encode frame %d failed: %v", i, err)
+		}
+		for _, p := range pkts {
+			stream = append(stream, p.Data)
+		}
+	}
+	return stream
+}
+
+func decodeStream(tb testing.TB, opts DecoderOptions, stream [][]byte, check func(*Frame)) {
+	tb.Helper()
+	dec, err := NewDecoder(CodecVP9, opts)
+	if err != nil {
+		tb.Fatalf("NewDecoder(%+v) failed: %v", opts, err)
+	}
+	defer dec.Close()
+	for i, data := range stream {
+		frames, err := dec.Decode(data)
+		if err != nil || len(frames) != 1 {
+			tb.Fatalf("Decode frame %d = %d frames, %v", i, len(frames), err)
+		}
+		if check != nil {
+			check(frames[0])
+		}
+	}
+}
+
+func TestDecoderTuning(t *testing.T) {
+	stream := encodeTiledVP9(t, 640, 360, 100, 1, 4)
+	var want []*Frame
+	decodeStream(t, DecoderOptions{}, stream, func(f *Frame) {
+		want = append(want, f.Clone())
+	})
+
+	// None of the threading or layout options may change the output.
+	exact := []DecoderOptions{
+		{Threads: 4, RowMT: true},
+		{Threads: 4, RowMT: true, LoopFilterOpt: true},
+		{Threads: 2, InvertTileDecodeOrder: true},
+		{ByteAlignment: 64},
+	}
+	for _, opts := range exact {
+		var n int
+		decodeStream(t, opts, stream, func(f *Frame) {
+			if !equalImages(f.Image(), want[n].Image()) {
+				t.Errorf("%+v: frame %d differs from the default decode", opts, n)
+			}
+			if opts.ByteAlignment != 0 {
+				for p := PlaneY; p <= PlaneV; p++ {
+					if addr := uintptr(unsafe.Pointer(f.Image().Planes[p])); addr%uintptr(opts.ByteAlignment) != 0 {
+						t.Errorf("frame %d plane %d at %#x is not %d-byte aligned", n, p, addr, opts.ByteAlignment)
+					}
+				}
+			}
+			n++
+		})
+	}
+
+	var differs bool
+	var n int
+	decodeStream(t, DecoderOptions{SkipLoopFilter: true}, stream, func(f *Frame) {
+		differs = differs || !equalImages(f.Image(), want[n].Image())
+		n++
+	})
+	if !differs {
+		t.Error("SkipLoopFilter did not change the output")
+	}
+}
+
+func TestDecoderSetSkipLoopFilter(t *testing.T) {
+	stream := encodeTiledVP9(t, 640, 360, 100, 0, 2)
+	plain, err := NewDecoder(CodecVP9, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer plain.Close()
+	dec, err := NewDecoder(CodecVP9, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer dec.Close()
+
+	for i, skip := range []bool{false, true} {
+		if err := dec.SetSkipLoopFilter(skip); err != nil {
+			t.Fatalf("SetSkipLoopFilter(%v) failed: %v", skip, err)
+		}
+		if err := dec.SetByteAlignment(32); err != nil {
+			t.Fatalf("SetByteAlignment failed: %v", err)
+		}
+		want, err := plain.Decode(stream[i])
+		if err != nil || len(want) != 1 {
+			t.Fatalf("frame %d: decode = %d frames, %v", i, len(want), err)
+		}
+		got, err := dec.Decode(stream[i])
+		if err != nil || len(got) != 1 {
+			t.Fatalf("frame %d: decode = %d frames, %v", i, len(got), err)
+		}
+		if same := equalImages(got[0].Image(), want[0].Image()); same == skip {
+			t.Errorf("frame %d: skip loop filter %v, output equal to default decode = %v", i, skip, same)
+		}
+	}
+}
+
+func TestDecoderTuningErrors(t *testing.T) {
+	if _, err := NewDecoder(CodecVP8, DecoderOptions{RowMT: true}); !errors.Is(err, ErrCodecIncapable) {
+		t.Errorf("VP8 RowMT = %v, want ErrCodecIncapable", err)
+	}
+	for _, align := range []int{16, 48, 2048} {
+		if _, err := NewDecoder(CodecVP9, DecoderOptions{ByteAlignment: align}); !errors.Is(err, ErrCodecInvalidParam) {
+			t.Errorf("ByteAlignment %d = %v, want ErrCodecInvalidParam", align, err)
+		}
+	}
+
+	vp8, err := NewDecoder(CodecVP8, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer vp8.Close()
+	if err := vp8.SetSkipLoopFilter(true); !errors.Is(err, ErrCodecIncapable) {
+		t.Errorf("VP8 SetSkipLoopFilter = %v, want ErrCodecIncapable", err)
+	}
+	if err := vp8.SetByteAlignment(32); !errors.Is(err, ErrCodecIncapable) {
+		t.Errorf("VP8 SetByteAlignment = %v, want ErrCodecIncapable", err)
+	}
+
+	vp9, err := NewDecoder(CodecVP9, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	if err := vp9.SetByteAlignment(100); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("SetByteAlignment(100) = %v, want ErrCodecInvalidParam", err)
+	}
+	vp9.Close()
+	if err := vp9.SetSkipLoopFilter(true); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("closed: SetSkipLoopFilter = %v, want ErrCodecClosed", err)
+	}
+}
+
+// BenchmarkDecodeVP9RowMT compares tile-parallel decoding with row-based
+// multi-threading on a 720p stream with four tile columns. Both only pay off
+// on machines with more than one core.
+func BenchmarkDecodeVP9RowMT(b *testing.B) {
+	stream := encodeTiledVP9(b, 1280, 720, 4000, 2, 10)
+	var size int
+	for _, data := range stream {
+		size += len(data)
+	}
+	for _, bm := range []struct {
+		name string
+		opts DecoderOptions
+	}{
+		{"single", DecoderOptions{Threads: 1}},
+		{"tiles", DecoderOptions{Threads: 4}},
+		{"rowmt", DecoderOptions{Threads: 4, RowMT: true}},
+		{"rowmt-lfopt", DecoderOptions{Threads: 4, RowMT: true, LoopFilterOpt: true}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				decodeStream(b, bm.opts, stream, nil)
+			}
+			b.ReportMetric(float64(b.N*len(stream))/b.Elapsed().Seconds(), "frames/s")
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package vpx
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"unsafe"
+)
+
+// DecryptState locates the bytes a Decryptor is asked to decrypt.
+type DecryptState struct {
+	// Offset is the position of the input in the frame: in the data passed
+	// to Decoder.Decode, or in the fragments passed to
+	// Decoder.DecodeFragment since the last frame, laid end to end.
+	Offset int
+}
+
+// Decryptor decrypts the frames of a decoder created with
+// DecoderOptions.Decryptor, such as encrypted WebM blocks. Frames are not
+// decrypted up front: the decoder calls Decrypt for each range it reads
+// while it parses the frame, in any order and possibly more than once, so
+// the cipher must be able to start at any offset, like a stream cipher.
+type Decryptor interface {
+	// Decrypt writes the decryption of input, found at state.Offset in the
+	// frame, to output, which has the same length.
+	Decrypt(state DecryptState, input, output []byte)
+}
+
+// decryptRegion maps the memory holding part of the frame being decoded
+// to its offset in the frame.
+type decryptRegion struct {
+	start, size uintptr
+	offset      int
+}
+
+// SetDecryptor makes the decoder decrypt the frames passed to it from now
+// on with dec. A nil dec stops decryption.
+func (d *Decoder) SetDecryptor(dec Decryptor) error {
+	if d.ctx == nil {
+		return ErrCodecClosed
+	}
+	var fn DecryptFunc
+	if dec != nil {
+		fn = func(input, output []byte) {
+			offset, ok := d.inputOffset(input)
+			if !ok {
+				// libvpx only reads the frame it is given.
+				copy(output, input)
+				return
+			}
+			dec.Decrypt(DecryptState{Offset: offset}, input, output)
+		}
+	}
+	return codecError(d.ctx, "set decryptor", SetDecryptCallback(d.ctx, fn))
+}
+
+// addDecryptRegion records that data holds the next bytes of the frame.
+func (d *Decoder) addDecryptRegion(data unsafe.Pointer, size int) {
+	var offset int
+	if n := len(d.decryptRegions); n > 0 {
+		last := d.decryptRegions[n-1]
+		offset = last.offset + int(last.size)
+	}
+	d.decryptRegions = append(d.decryptRegions, decryptRegion{
+		start:  uintptr(data),
+		size:   uintptr(size),
+		offset: offset,
+	})
+}
+
+func (d *Decoder) clearDecryptRegions() {
+	d.decryptRegions = d.decryptRegions[:0]
+}
+
+// inputOffset returns the offset in the frame of the bytes libvpx asks to
+// decrypt.
+func (d *Decoder) inputOffset(input []byte) (int, bool) {
+	p := uintptr(unsafe.Pointer(unsafe.SliceData(input)))
+	for _, r := range d.decryptRegions {
+		if p-r.start < r.size {
+			return r.offset + int(p-r.start), true
+		}
+	}
+	return 0, false
+}
+
+// AESCTR is a Decryptor for frames encrypted with AES in counter mode, as
+// in WebM encryption. The counter block of a frame starts with its IV,
+// followed by zeros, and is incremented as a 128-bit big-endian integer for
+// every 16 bytes of the frame. Since counter mode is symmetric, AESCTR also
+// encrypts frames with XORKeyStream.
+//
+// The IV must be set with SetIV before each frame is decoded. An AESCTR
+// must not be shared by decoders running concurrently.
+type AESCTR struct {
+	block cipher.Block
+	iv    [aes.BlockSize]byte
+}
+
+// NewAESCTR returns an AESCTR decrypting with key, which must be 16, 24 or
+// 32 bytes long. The IV is all zeros until SetIV is called.
+func NewAESCTR(key []byte) (*AESCTR, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCodecInvalidParam, err)
+	}
+	return &AESCTR{block: block}, nil
+}
+
+// SetIV sets the IV of the next frame: 8 bytes, as stored in encrypted WebM
+// blocks, or a full 16-byte counter block.
+func (c *AESCTR) SetIV(iv []byte) error {
+	if len(iv) != 8 && len(iv) != aes.BlockSize {
+		return fmt.Errorf("%w: IV is %d bytes, want 8 or %d", ErrCodecInvalidParam, len(iv), aes.BlockSize)
+	}
+	c.iv = [aes.BlockSize]byte{}
+	copy(c.iv[:], iv)
+	return nil
+}
+
+// Decrypt implements Decryptor.
+func (c *AESCTR) Decrypt(state DecryptState, input, output []byte) {
+	c.XORKeyStream(output, input, state.Offset)
+}
+
+// XORKeyStream XORs src, found at offset in the frame, with the key stream
+// of the current IV into dst, which must be at least as long as src. It
+// encrypts a frame when called with offset 0 and the whole frame.
+func (c *AESCTR) XORKeyStream(dst, src []byte, offset int) {
+	var counter, stream [aes.BlockSize]byte
+	hi := binary.BigEndian.Uint64(c.iv[:8])
+	lo := binary.BigEndian.Uint64(c.iv[8:])
+	block := uint64(offset / aes.BlockSize)
+	skip := offset % aes.BlockSize
+	if lo+block < lo {
+		hi++
+	}
+	lo += block
+	for len(src) > 0 {
+		binary.BigEndian.PutUint64(counter[:8], hi)
+		binary.BigEndian.PutUint64(counter[8:], lo)
+		c.block.Encrypt(stream[:], counter[:])
+		n := copy(dst, src[:min(len(src), aes.BlockSize-skip)])
+		for i := 0; i < n; i++ {
+			dst[i] ^= stream[skip+i]
+		}
+		dst, src = dst[n:], src[n:]
+		skip = 0
+		if lo++; lo == 0 {
+			hi++
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package vpx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+var testDecryptKey = []byte("0123456789abcdef")
+
+func TestAESCTRKeyStream(t *testing.T) {
+	ivs := [][]byte{
+		{1, 2, 3, 4, 5, 6, 7, 8},
+		// The low half of the counter wraps around inside the stream.
+		bytes.Repeat([]byte{0xff}, 16),
+	}
+	src := make([]byte, 200)
+	for i := range src {
+		src[i] = byte(i)
+	}
+	block, err := aes.NewCipher(testDecryptKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctr, err := NewAESCTR(testDecryptKey)
+	if err != nil {
+		t.Fatalf("NewAESCTR failed: %v", err)
+	}
+	for _, iv := range ivs {
+		counter := make([]byte, aes.BlockSize)
+		copy(counter, iv)
+		want := make([]byte, len(src))
+		cipher.NewCTR(block, counter).XORKeyStream(want, src)
+
+		if err := ctr.SetIV(iv); err != nil {
+			t.Fatalf("SetIV failed: %v", err)
+		}
+		for _, r := range []struct{ offset, n int }{{0, 200}, {0, 9}, {5, 9}, {16, 16}, {31, 40}, {190, 10}} {
+			got := make([]byte, r.n)
+			ctr.XORKeyStream(got, src[r.offset:r.offset+r.n], r.offset)
+			if !bytes.Equal(got, want[r.offset:r.offset+r.n]) {
+				t.Errorf("IV %x: %d bytes at %d differ from crypto/cipher", iv, r.n, r.offset)
+			}
+		}
+	}
+
+	if _, err := NewAESCTR([]byte("short")); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("NewAESCTR with a 5-byte key = %v, want ErrCodecInvalidParam", err)
+	}
+	if err := ctr.SetIV(make([]byte, 12)); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("SetIV with 12 bytes = %v, want ErrCodecInvalidParam", err)
+	}
+}
+
+// encryptFrame encrypts a copy of data as frame i of a stream.
+func encryptFrame(t *testing.T, ctr *AESCTR, i int, data []byte) []byte {
+	t.Helper()
+	if err := ctr.SetIV(frameIV(i)); err != nil {
+		t.Fatalf("SetIV failed: %v", err)
+	}
+	encrypted := make([]byte, len(data))
+	ctr.XORKeyStream(encrypted, data, 0)
+	return encrypted
+}
+
+func frameIV(i int) []byte {
+	return binary.BigEndian.AppendUint64(nil, 0x5eed0000+uint64(i))
+}
+
+func TestDecoderDecryptVP8Partitions(t *testing.T) {
+	enc := newRealtimeEncoder(t, CodecVP8)
+	if err := enc.SetTokenPartitions(FourTokenPartitions); err != nil {
+		t.Fatalf("SetTokenPartitions failed: %v", err)
+	}
+	plain, err := NewDecoder(CodecVP8, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer plain.Close()
+	encrypter, err := NewAESCTR(testDecryptKey)
+	if err != nil {
+		t.Fatalf("NewAESCTR failed: %v", err)
+	}
+	decrypter, err := NewAESCTR(testDecryptKey)
+	if err != nil {
+		t.Fatalf("NewAESCTR failed: %v", err)
+	}
+	whole, err := NewDecoder(CodecVP8, DecoderOptions{Decryptor: decrypter})
+	if err != nil {
+		t.Fatalf("NewDecoder(Decryptor) failed: %v", err)
+	}
+	defer whole.Close()
+	fragmented, err := NewDecoder(CodecVP8, DecoderOptions{Decryptor: decrypter, InputFragments: true})
+	if err != nil {
+		t.Fatalf("NewDecoder(Decryptor, InputFragments) failed: %v", err)
+	}
+	defer fragmented.Close()
+
+	img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+	defer ImageFree(img)
+	img.Deref()
+
+	for i := 0; i < 4; i++ {
+		fillTestPattern(img, i)
+		pkts, err := enc.Encode(img, CodecPts(i), 0)
+		if err != nil || len(pkts) != 1 {
+			t.Fatalf("Encode frame %d = %d packets, %v", i, len(pkts), err)
+		}
+		want, err := plain.Decode(pkts[0].Data)
+		if err != nil || len(want) != 1 {
+			t.Fatalf("frame %d: decode = %d frames, %v", i, len(want), err)
+		}
+		encrypted := encryptFrame(t, encrypter, i, pkts[0].Data)
+
+		if err := decrypter.SetIV(frameIV(i)); err != nil {
+			t.Fatalf("SetIV failed: %v", err)
+		}
+		got, err := whole.Decode(encrypted)
+		if err != nil || len(got) != 1 {
+			t.Fatalf("frame %d: encrypted decode = %d frames, %v", i, len(got), err)
+		}
+		if !equalImages(got[0].Image(), want[0].Image()) {
+			t.Errorf("frame %d decrypted as a whole differs", i)
+		}
+
+		// Cut the encrypted frame where its plain partitions end.
+		var offset int
+		for _, part := range splitVP8Partitions(t, pkts[0].Data, 4) {
+			if err := fragmented.DecodeFragment(encrypted[offset : offset+len(part)]); err != nil {
+				t.Fatalf("frame %d: DecodeFragment failed: %v", i, err)
+			}
+			offset += len(part)
+		}
+		got, err = fragmented.EndFrame()
+		if err != nil || len(got) != 1 {
+			t.Fatalf("frame %d: EndFrame = %d frames, %v", i, len(got), err)
+		}
+		if !equalImages(got[0].Image(), want[0].Image()) {
+			t.Errorf("frame %d decrypted from partitions differs", i)
+		}
+	}
+}
+
+func TestDecoderDecryptVP9(t *testing.T) {
+	packets := encodeTestPackets(t, CodecVP9, 320, 240, 4)
+	want := decodeVP9Reference(t, packets)
+	encrypter, err := NewAESCTR(testDecryptKey)
+	if err != nil {
+		t.Fatalf("NewAESCTR failed: %v", err)
+	}
+	decrypter, err := NewAESCTR(testDecryptKey)
+	if err != nil {
+		t.Fatalf("NewAESCTR failed: %v", err)
+	}
+	dec, err := NewDecoder(CodecVP9, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer dec.Close()
+
+	encrypted := encryptFrame(t, encrypter, 0, packets[0].Data)
+	if _, err := dec.Decode(encrypted); err == nil {
+		t.Error("encrypted keyframe decoded without a decryptor")
+	}
+	if err := dec.SetDecryptor(decrypter); err != nil {
+		t.Fatalf("SetDecryptor failed: %v", err)
+	}
+	for i, p := range packets {
+		if err := decrypter.SetIV(frameIV(i)); err != nil {
+			t.Fatalf("SetIV failed: %v", err)
+		}
+		got, err := dec.Decode(encryptFrame(t, encrypter, i, p.Data))
+		if err != nil || len(got) != 1 {
+			t.Fatalf("frame %d: encrypted decode = %d frames, %v", i, len(got), err)
+		}
+		if !equalImages(got[0].Image(), want[i].Image()) {
+			t.Errorf("frame %d decrypted differs", i)
+		}
+	}
+
+	// Without the decryptor, plain frames decode again.
+	if err := dec.SetDecryptor(nil); err != nil {
+		t.Fatalf("SetDecryptor(nil) failed: %v", err)
+	}
+	if _, err := dec.Decode(packets[0].Data); err != nil {
+		t.Errorf("plain keyframe after SetDecryptor(nil): %v", err)
+	}
+	dec.Close()
+	if err := dec.SetDecryptor(decrypter); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("closed: SetDecryptor = %v, want ErrCodecClosed", err)
+	}
+}
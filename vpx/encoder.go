@@ -0,0 +1,427 @@
+package vpx
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+// EncoderOptions configures an Encoder created by NewEncoder.
+// Zero values keep the defaults returned by CodecEncConfigDefault.
+type EncoderOptions struct {
+	// Config, when set, is validated and applied first. The fields below
+	// override it where they are non-zero.
+	Config *EncoderConfig
+	// Width and Height are the dimensions of the frames passed to Encode.
+	Width  uint32
+	Height uint32
+	// Timebase is the unit of the pts passed to Encode. Defaults to 1/30.
+	Timebase Rational
+	// Bitrate is the target bitrate in kilobits per second.
+	Bitrate uint32
+	// RateControl selects the rate control mode (Vbr, Cbr, Cq or Q).
+	RateControl RcMode
+	// Threads is the maximum number of encoder threads.
+	Threads uint32
+	// KeyframeMaxDist is the maximum distance between keyframes, in frames.
+	KeyframeMaxDist uint32
+	// ErrorResilient enables error resilient coding modes.
+	ErrorResilient CodecErFlags
+	// Deadline is passed to every CodecEncode call. Defaults to the Deadline
+	// of Config, or DlGoodQuality.
+	Deadline uint
+	// Flags are passed to CodecEncInitVer.
+	Flags CodecFlags
+	// SVC, when set, enables VP9 scalable video coding with the given layers.
+	// It overrides Bitrate with the sum of the layer bitrates. Set
+	// ErrorResilient if receivers may decode a subset of the spatial layers.
+	SVC *SVCConfig
+	// TemporalLayering, when set, enables VP8 temporal scalability. Encode
+	// then sets the layer id and reference flags of every frame and tags
+	// packets with their layer, starting at the first frame of the pattern.
+	// It overrides Bitrate with the top layer rate. The encoder keeps its
+	// own copy, so the layering may be reused or shared.
+	TemporalLayering *TemporalLayering
+	// Configure, when set, is called after the fields above have been applied
+	// and may adjust any field of the configuration before initialization.
+	Configure func(cfg *CodecEncCfg)
+}
+
+// Packet is a compressed frame produced by an Encoder.
+// Its data is owned by Go and remains valid after further encoder calls.
+type Packet struct {
+	Data     []byte
+	Pts      CodecPts
+	Duration uint
+	Flags    CodecFrameFlags
+	// TemporalLayer is the temporal layer of the frame when the encoder was
+	// created with EncoderOptions.TemporalLayering, or of a packet delivered
+	// to a SetPacketCallback callback with SVC. It is zero otherwise.
+	TemporalLayer int
+	// SpatialLayer is the spatial layer of a packet delivered to a
+	// SetPacketCallback callback with SVC, zero otherwise.
+	SpatialLayer int
+}
+
+// IsKeyframe returns true if the packet holds a keyframe.
+func (p *Packet) IsKeyframe() bool {
+	return p.Flags&FrameIsKey != 0
+}
+
+// IsDroppable returns true if no other frame references this packet.
+func (p *Packet) IsDroppable() bool {
+	return p.Flags&FrameIsDroppable != 0
+}
+
+// IsInvisible returns true if the packet decodes to a frame that is not shown.
+func (p *Packet) IsInvisible() bool {
+	return p.Flags&FrameIsInvisible != 0
+}
+
+// Encoder wraps an initialized encoder CodecCtx and its configuration.
+// An Encoder is not safe for concurrent use.
+type Encoder struct {
+	codec    Codec
+	ctx      *CodecCtx
+	cfg      *CodecEncCfg
+	deadline uint
+	temporal *TemporalLayering
+	// svc records whether the encoder was created with SVC.
+	svc bool
+	// recovery holds the references of a requested recovery frame.
+	recovery RefFrameType
+	// layers queues the pts and temporal layer of frames awaiting output.
+	layers []temporalPts
+	// stats collects the output of a first pass, and statsIn is the C copy
+	// of the statistics a last pass reads from.
+	stats   []byte
+	statsIn unsafe.Pointer
+	// frameRate is the EncoderConfig.FrameRate the encoder was last
+	// configured with.
+	frameRate float64
+	// keyframe forces the next frame to be a keyframe after a resolution
+	// change.
+	keyframe bool
+}
+
+type temporalPts struct {
+	pts   CodecPts
+	layer int
+}
+
+// NewEncoder initializes a VP8 or VP9 encoder configured by opts.
+// The returned Encoder must be released with Close.
+func NewEncoder(codec Codec, opts EncoderOptions) (*Encoder, error) {
+	iface := EncoderFor(int(codec))
+	if iface == nil {
+		return nil, fmt.Errorf("%w: unsupported codec %d", ErrCodecInvalidParam, int(codec))
+	}
+	if opts.SVC != nil {
+		if codec != CodecVP9 {
+			return nil, fmt.Errorf("%w: svc is only supported by %s", ErrCodecIncapable, CodecVP9)
+		}
+		if err := opts.SVC.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if opts.TemporalLayering != nil {
+		if codec != CodecVP8 {
+			return nil, fmt.Errorf("%w: temporal layering is only supported by %s", ErrCodecIncapable, CodecVP8)
+		}
+		if err := opts.TemporalLayering.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Config != nil {
+		if opts.Config.Codec != codec {
+			return nil, fmt.Errorf("%w: config is for %s, not %s", ErrCodecInvalidParam, opts.Config.Codec, codec)
+		}
+		if err := opts.Config.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg, err := defaultEncCfg(codec)
+	if err != nil {
+		return nil, err
+	}
+	opts.apply(cfg)
+	var statsIn unsafe.Pointer
+	if opts.Config != nil && opts.Config.Pass == RcLastPass {
+		// libvpx reads the statistics as it encodes.
+		stats := opts.Config.TwoPassStats
+		statsIn = C.CBytes(stats)
+		cfg.RcTwopassStatsIn = FixedBuf{Buf: statsIn, Sz: uint(len(stats))}
+	}
+
+	ctx := NewCodecCtx()
+	if err := codecError(ctx, "encoder init", CodecEncInitVer(ctx, iface, cfg, opts.Flags, EncoderABIVersion)); err != nil {
+		ctx.Free()
+		cfg.Free()
+		C.free(statsIn)
+		return nil, err
+	}
+	if opts.SVC != nil {
+		if err := enableSVC(ctx, opts.SVC); err != nil {
+			CodecDestroy(ctx)
+			ctx.Free()
+			cfg.Free()
+			C.free(statsIn)
+			return nil, err
+		}
+	}
+
+	deadline := opts.Deadline
+	var frameRate float64
+	if opts.Config != nil {
+		if deadline == 0 {
+			deadline = opts.Config.Deadline
+		}
+		frameRate = opts.Config.FrameRate
+	}
+	if deadline == 0 {
+		deadline = DlGoodQuality
+	}
+	return &Encoder{
+		codec:     codec,
+		ctx:       ctx,
+		cfg:       cfg,
+		deadline:  deadline,
+		temporal:  opts.TemporalLayering.clone(),
+		svc:       opts.SVC != nil,
+		statsIn:   statsIn,
+		frameRate: frameRate,
+	}, nil
+}
+
+func (opts *EncoderOptions) apply(cfg *CodecEncCfg) {
+	if opts.Config != nil {
+		opts.Config.ApplyTo(cfg)
+	} else {
+		cfg.GTimebase = Rational{Num: 1, Den: 30}
+		cfg.GPass = RcOnePass
+	}
+	if opts.Width != 0 {
+		cfg.GW = opts.Width
+	}
+	if opts.Height != 0 {
+		cfg.GH = opts.Height
+	}
+	if opts.Timebase.Num != 0 && opts.Timebase.Den != 0 {
+		cfg.GTimebase = Rational{Num: opts.Timebase.Num, Den: opts.Timebase.Den}
+	}
+	if opts.Bitrate != 0 {
+		cfg.RcTargetBitrate = opts.Bitrate
+	}
+	if opts.RateControl != 0 {
+		cfg.RcEndUsage = opts.RateControl
+	}
+	if opts.Threads != 0 {
+		cfg.GThreads = opts.Threads
+	}
+	if opts.KeyframeMaxDist != 0 {
+		cfg.KfMaxDist = opts.KeyframeMaxDist
+	}
+	if opts.ErrorResilient != 0 {
+		cfg.GErrorResilient = opts.ErrorResilient
+	}
+	if opts.SVC != nil {
+		opts.SVC.apply(cfg)
+	}
+	if opts.TemporalLayering != nil {
+		opts.TemporalLayering.apply(cfg)
+	}
+	if opts.Configure != nil {
+		opts.Configure(cfg)
+	}
+}
+
+// Codec returns the codec this encoder produces.
+func (e *Encoder) Codec() Codec {
+	return e.codec
+}
+
+// Ctx returns the underlying codec context for use with the low-level API.
+// It is nil once the encoder has been closed.
+func (e *Encoder) Ctx() *CodecCtx {
+	return e.ctx
+}
+
+// Encode compresses img, presented at pts with a duration of one timebase
+// unit, and returns the packets the encoder produced for it.
+// Encoders with lag may return no packets until later calls or Flush.
+func (e *Encoder) Encode(img *Image, pts CodecPts, flags EncFrameFlags) ([]Packet, error) {
+	if e.ctx == nil {
+		return nil, ErrCodecClosed
+	}
+	if img == nil {
+		return nil, fmt.Errorf("%w: nil image", ErrCodecInvalidParam)
+	}
+	if e.temporal != nil {
+		layer, layerFlags := e.temporal.Next()
+		if err := e.SetTemporalLayerID(layer); err != nil {
+			return nil, err
+		}
+		flags |= layerFlags
+		e.layers = append(e.layers, temporalPts{pts: pts, layer: layer})
+	}
+	if e.recovery != 0 {
+		flags = flags.ReferenceOnly(e.recovery)
+		e.recovery = 0
+	}
+	if e.keyframe {
+		flags = flags.ForceKeyframe()
+	}
+	pkts, err := e.encode(img, pts, 1, flags)
+	if err == nil {
+		e.keyframe = false
+	}
+	return pkts, err
+}
+
+// RequestRecoveryFrame makes the next Encode predict only from refs, for
+// example RefGolden after the receiver reported losing frames that the last
+// frame depends on. The recovered frame refreshes the last frame as usual,
+// so the frames after it decode again on the receiver. VP9 streams must be
+// encoded with ErrorResilient for the receiver to match the encoder.
+func (e *Encoder) RequestRecoveryFrame(refs RefFrameType) error {
+	if refs == 0 || refs&^RefAll != 0 {
+		return fmt.Errorf("%w: invalid reference frames %#x", ErrCodecInvalidParam, int(refs))
+	}
+	if e.ctx == nil {
+		return ErrCodecClosed
+	}
+	e.recovery = refs
+	return nil
+}
+
+// Flush signals the end of the stream and returns all packets still
+// buffered inside the encoder.
+func (e *Encoder) Flush() ([]Packet, error) {
+	if e.ctx == nil {
+		return nil, ErrCodecClosed
+	}
+	var packets []Packet
+	for {
+		pkts, err := e.encode(nil, 0, 0, 0)
+		if err != nil {
+			return packets, err
+		}
+		if len(pkts) == 0 {
+			return packets, nil
+		}
+		packets = append(packets, pkts...)
+	}
+}
+
+func (e *Encoder) encode(img *Image, pts CodecPts, duration uint, flags EncFrameFlags) ([]Packet, error) {
+	if err := codecError(e.ctx, "encode", CodecEncode(e.ctx, img, pts, duration, flags, e.deadline)); err != nil {
+		return nil, err
+	}
+	return e.packets(), nil
+}
+
+func (e *Encoder) packets() []Packet {
+	var packets []Packet
+	var iter CodecIter
+	for pkt := CodecGetCxData(e.ctx, &iter); pkt != nil; pkt = CodecGetCxData(e.ctx, &iter) {
+		pkt.Deref()
+		if pkt.Kind == CodecStatsPkt {
+			e.stats = append(e.stats, pkt.GetTwopassStats()...)
+			continue
+		}
+		if pkt.Kind != CodecCxFramePkt {
+			continue
+		}
+		p := newPacket(pkt)
+		p.TemporalLayer = e.temporalLayer(p.Pts)
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+// newPacket copies the frame packet pkt into Go memory.
+func newPacket(pkt *CodecCxPkt) Packet {
+	return Packet{
+		Data:     pkt.GetFrameData(),
+		Pts:      pkt.GetFramePts(),
+		Duration: pkt.GetFrameDuration(),
+		Flags:    pkt.GetFrameFlags(),
+	}
+}
+
+// SetPacketCallback makes the VP9 encoder hand every packet to fn as soon as
+// it is produced, from within Encode and Flush, which then return no
+// packets. With SVC each spatial layer arrives as its own packet, tagged
+// with its layers, instead of one superframe. fn must not call Encode or
+// Flush. A nil fn restores returning the packets from Encode.
+func (e *Encoder) SetPacketCallback(fn func(Packet)) error {
+	if err := e.requireCodec(CodecVP9, "packet callback"); err != nil {
+		return err
+	}
+	if e.ctx == nil {
+		return ErrCodecClosed
+	}
+	var cb OutputPacketFunc
+	if fn != nil {
+		cb = func(pkt *CodecCxPkt) {
+			if pkt.Kind != CodecCxFramePkt {
+				return
+			}
+			p := newPacket(pkt)
+			if e.svc {
+				// The layer id still describes the layer being output.
+				if id, err := CodecControlGetSVCLayerID(e.ctx); err == CodecOk {
+					p.SpatialLayer, p.TemporalLayer = id.SpatialLayerID, id.TemporalLayerID
+				}
+			}
+			fn(p)
+		}
+	}
+	return codecError(e.ctx, "register cx callback", RegisterOutputPacketCallback(e.ctx, cb))
+}
+
+// TwoPassStats returns the statistics gathered so far by an encoder
+// created with a Config for RcFirstPass, which produces no packets. Pass
+// them as the TwoPassStats of the last pass once the first has been
+// flushed.
+func (e *Encoder) TwoPassStats() []byte {
+	return e.stats
+}
+
+// temporalLayer returns the layer Encode assigned to the frame at pts,
+// discarding queued frames before it that the encoder dropped.
+func (e *Encoder) temporalLayer(pts CodecPts) int {
+	for len(e.layers) > 0 {
+		f := e.layers[0]
+		if f.pts > pts {
+			break
+		}
+		e.layers = e.layers[1:]
+		if f.pts == pts {
+			return f.layer
+		}
+	}
+	return 0
+}
+
+// Close destroys the encoder and frees its C resources.
+// It is safe to call Close more than once.
+func (e *Encoder) Close() error {
+	if e.ctx == nil {
+		return nil
+	}
+	err := codecError(e.ctx, "destroy", CodecDestroy(e.ctx))
+	UnregisterCallbacks(e.ctx)
+	e.ctx.Free()
+	e.cfg.Free()
+	C.free(e.statsIn)
+	e.ctx = nil
+	e.cfg = nil
+	e.statsIn = nil
+	return err
+}
@@ -0,0 +1,620 @@
+package vpx
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// EncoderConfig is a Go-native encoder configuration, with sizes in pixels,
+// rates in kbps and intervals as durations. Unlike CodecEncCfg it can be
+// checked with Validate before an encoder is created. Start from
+// NewEncoderConfig or one of the presets (RealtimeCBR, VODTwoPass and
+// Lossless), and pass it as EncoderOptions.Config.
+//
+// Spatial layers are not part of it: configure them with
+// EncoderOptions.SVC.
+type EncoderConfig struct {
+	// Codec is the codec the configuration is for.
+	Codec Codec
+	// Width and Height are the dimensions of the frames passed to Encode.
+	Width, Height int
+	// Format is the format of the frames passed to Encode. It decides the
+	// VP9 profile and defaults to ImageFormatI420.
+	Format ImageFormat
+	// Profile is the bitstream profile. VP9 needs profile 0 for 8-bit 4:2:0
+	// frames, 1 for other 8-bit frames, and 2 and 3 likewise for high bit
+	// depth frames.
+	Profile int
+	// BitDepth is the bit depth of the stream: 8, 10 or 12. Zero means 8.
+	BitDepth int
+	// Timebase is the unit of the pts passed to Encode. Zero means 1/30.
+	Timebase Rational
+	// FrameRate is the number of frames per second, used to convert the
+	// durations below to frames. Zero means one frame per Timebase unit.
+	FrameRate float64
+	// Deadline is passed to every CodecEncode call, such as DlRealtime.
+	// Zero means DlGoodQuality, unless EncoderOptions.Deadline is set.
+	Deadline uint
+	// Threads is the maximum number of encoder threads.
+	Threads int
+	// Lag is the number of frames the encoder may buffer to look ahead.
+	Lag int
+	// ErrorResilient enables error resilient coding modes.
+	ErrorResilient CodecErFlags
+
+	// Pass is RcOnePass, or RcFirstPass and RcLastPass for the two passes
+	// of two-pass encoding.
+	Pass EncPass
+	// TwoPassStats holds the statistics gathered by the first pass, as
+	// returned by Encoder.TwoPassStats. The last pass needs them.
+	TwoPassStats []byte
+
+	// RateControl selects the rate control mode (Vbr, Cbr, Cq or Q).
+	RateControl RcMode
+	// Bitrate is the target bitrate in kbps. Q mode ignores it.
+	Bitrate int
+	// MinQuantizer and MaxQuantizer bound the quantizer, from 0 to 63.
+	MinQuantizer, MaxQuantizer int
+	// UndershootPct and OvershootPct are how far, in percent of Bitrate,
+	// the encoder may stray from the target to keep quality even.
+	UndershootPct, OvershootPct int
+	// BufferSize, BufferInitialSize and BufferOptimalSize are the size and
+	// levels of the decoder buffer the rate control models, in playback
+	// time at Bitrate.
+	BufferSize, BufferInitialSize, BufferOptimalSize time.Duration
+	// DropFrameThreshold is the buffer level, in percent of BufferSize,
+	// below which frames are dropped to meet the bitrate. Zero never drops.
+	DropFrameThreshold int
+
+	// AutoKeyframes lets the encoder place keyframes, at most
+	// KeyframeMaxInterval apart. Without it, only the first frame and the
+	// frames encoded with EflagForceKf are keyframes.
+	AutoKeyframes bool
+	// KeyframeMinInterval and KeyframeMaxInterval bound the distance
+	// between automatic keyframes. For VP9, libvpx only supports a minimum
+	// of zero or equal to the maximum.
+	KeyframeMinInterval, KeyframeMaxInterval time.Duration
+
+	// TemporalLayerBitrates holds the cumulative target bitrate in kbps of
+	// each temporal layer, if any. The top one must equal Bitrate.
+	TemporalLayerBitrates []int
+	// TemporalRateDecimators holds the frame rate divider of each temporal
+	// layer, halving from layer to layer down from 1 at the top.
+	TemporalRateDecimators []int
+	// TemporalPattern holds the layer of each frame of the repeating
+	// temporal layering pattern, at most TsMaxPeriodicity long.
+	TemporalPattern []int
+}
+
+// NewEncoderConfig returns the default configuration of libvpx for codec
+// with the given frame size.
+func NewEncoderConfig(codec Codec, width, height int) (*EncoderConfig, error) {
+	cfg, err := defaultEncCfg(codec)
+	if err != nil {
+		return nil, err
+	}
+	defer cfg.Free()
+	c := EncoderConfigFrom(codec, cfg)
+	c.Width, c.Height = width, height
+	c.Timebase = Rational{Num: 1, Den: 30}
+	return c, nil
+}
+
+// defaultEncCfg returns the default CodecEncCfg of codec. The caller frees it.
+func defaultEncCfg(codec Codec) (*CodecEncCfg, error) {
+	iface := EncoderFor(int(codec))
+	if iface == nil {
+		return nil, fmt.Errorf("%w: unsupported codec %d", ErrCodecInvalidParam, int(codec))
+	}
+	cfg := &CodecEncCfg{}
+	if err := CodecEncConfigDefault(iface, cfg, 0); err != CodecOk {
+		cfg.Free()
+		return nil, &CodecOpError{Code: err, Op: codec.String() + " config default", Message: CodecErrToString(err)}
+	}
+	cfg.Deref()
+	return cfg, nil
+}
+
+// RealtimeCBR returns a configuration for live streaming and video calls:
+// constant bitrate with a short buffer, no lookahead, the realtime deadline
+// and frame dropping when the bitrate cannot be met.
+func RealtimeCBR(codec Codec, width, height, kbps int) (*EncoderConfig, error) {
+	c, err := NewEncoderConfig(codec, width, height)
+	if err != nil {
+		return nil, err
+	}
+	c.Deadline = DlRealtime
+	c.Lag = 0
+	c.RateControl = Cbr
+	c.Bitrate = kbps
+	c.MinQuantizer, c.MaxQuantizer = 2, 56
+	c.UndershootPct, c.OvershootPct = 50, 50
+	c.BufferSize = time.Second
+	c.BufferInitialSize = 500 * time.Millisecond
+	c.BufferOptimalSize = 600 * time.Millisecond
+	c.DropFrameThreshold = 30
+	c.AutoKeyframes = true
+	c.KeyframeMinInterval, c.KeyframeMaxInterval = 0, 10*time.Second
+	return c, nil
+}
+
+// VODTwoPass returns a configuration for video on demand: variable bitrate
+// with the maximum lookahead, encoded in two passes. It is set up for the
+// first pass; for the second, set Pass to RcLastPass and TwoPassStats to the
+// statistics of the first.
+func VODTwoPass(codec Codec, width, height, kbps int) (*EncoderConfig, error) {
+	c, err := NewEncoderConfig(codec, width, height)
+	if err != nil {
+		return nil, err
+	}
+	c.Deadline = DlGoodQuality
+	c.Pass = RcFirstPass
+	c.Lag = maxLag
+	c.RateControl = Vbr
+	c.Bitrate = kbps
+	c.AutoKeyframes = true
+	c.KeyframeMinInterval, c.KeyframeMaxInterval = 0, 5*time.Second
+	return c, nil
+}
+
+// Lossless returns a VP9 configuration that reproduces the input exactly,
+// by fixing the quantizer at zero.
+func Lossless(width, height int) (*EncoderConfig, error) {
+	c, err := NewEncoderConfig(CodecVP9, width, height)
+	if err != nil {
+		return nil, err
+	}
+	c.Deadline = DlGoodQuality
+	c.RateControl = Q
+	c.MinQuantizer, c.MaxQuantizer = 0, 0
+	return c, nil
+}
+
+// maxLag is the largest lookahead libvpx supports, in frames.
+const maxLag = 25
+
+// Validate checks the configuration against the limits of libvpx and
+// returns an error explaining every invalid setting, or nil.
+func (c *EncoderConfig) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]any{ErrCodecInvalidParam}, args...)...))
+	}
+	check := func(name string, v, min, max int) {
+		if v < min || v > max {
+			invalid("%s %d out of range [%d, %d]", name, v, min, max)
+		}
+	}
+
+	maxSize, maxShootPct := 65535, 100
+	switch c.Codec {
+	case CodecVP8:
+		maxSize, maxShootPct = 16383, 1000
+	case CodecVP9:
+	default:
+		invalid("unsupported codec %d", int(c.Codec))
+	}
+	check("width", c.Width, 1, maxSize)
+	check("height", c.Height, 1, maxSize)
+	c.validateFormat(invalid)
+	if c.Timebase != (Rational{}) && (c.Timebase.Num <= 0 || c.Timebase.Den <= 0) {
+		invalid("timebase %d/%d is not positive", c.Timebase.Num, c.Timebase.Den)
+	}
+	if c.FrameRate < 0 || math.IsNaN(c.FrameRate) || math.IsInf(c.FrameRate, 0) {
+		invalid("frame rate %v is not a positive number", c.FrameRate)
+	}
+	check("threads", c.Threads, 0, 64)
+	check("lag", c.Lag, 0, maxLag)
+
+	switch c.Pass {
+	case RcOnePass, RcFirstPass:
+		if len(c.TwoPassStats) != 0 {
+			invalid("two-pass statistics are only used by the last pass")
+		}
+	case RcLastPass:
+		if len(c.TwoPassStats) == 0 {
+			invalid("the last pass needs the statistics of the first pass")
+		}
+	default:
+		invalid("unknown pass %d", c.Pass)
+	}
+
+	switch c.RateControl {
+	case Vbr, Cbr, Cq:
+		if c.Bitrate <= 0 {
+			invalid("bitrate %d is not positive", c.Bitrate)
+		}
+	case Q:
+	default:
+		invalid("unknown rate control mode %d", c.RateControl)
+	}
+	check("min quantizer", c.MinQuantizer, 0, 63)
+	check("max quantizer", c.MaxQuantizer, 0, 63)
+	if c.MinQuantizer > c.MaxQuantizer {
+		invalid("min quantizer %d is above max quantizer %d", c.MinQuantizer, c.MaxQuantizer)
+	}
+	check("undershoot percentage", c.UndershootPct, 0, maxShootPct)
+	check("overshoot percentage", c.OvershootPct, 0, maxShootPct)
+	if c.BufferSize < 0 || c.BufferInitialSize < 0 || c.BufferOptimalSize < 0 {
+		invalid("buffer sizes are negative")
+	}
+	if c.BufferInitialSize > c.BufferSize || c.BufferOptimalSize > c.BufferSize {
+		invalid("initial and optimal buffer levels %v and %v exceed the buffer size %v",
+			c.BufferInitialSize, c.BufferOptimalSize, c.BufferSize)
+	}
+	check("drop frame threshold", c.DropFrameThreshold, 0, 100)
+
+	if c.KeyframeMinInterval < 0 || c.KeyframeMaxInterval < 0 {
+		invalid("keyframe intervals are negative")
+	}
+	minDist, maxDist := c.frames(c.KeyframeMinInterval), c.frames(c.KeyframeMaxInterval)
+	if minDist > maxDist {
+		invalid("keyframe min interval %v exceeds the max interval %v", c.KeyframeMinInterval, c.KeyframeMaxInterval)
+	} else if c.Codec == CodecVP9 && c.AutoKeyframes && minDist > 0 && minDist != maxDist {
+		invalid("%s automatic keyframes need a keyframe min interval of zero or equal to the max interval", CodecVP9)
+	}
+
+	c.validateTemporalLayers(invalid)
+	return errors.Join(errs...)
+}
+
+// validateFormat checks that the frame format, profile and bit depth agree.
+func (c *EncoderConfig) validateFormat(invalid func(string, ...any)) {
+	format := c.format()
+	highBitDepth := format&ImageFormatHighbitdepth != 0
+	switch c.bitDepth() {
+	case 8:
+		if highBitDepth {
+			invalid("format %v needs a bit depth of 10 or 12", format)
+		}
+	case 10, 12:
+		if c.Codec != CodecVP9 {
+			invalid("bit depth %d is only supported by %s", c.bitDepth(), CodecVP9)
+		} else if !highBitDepth {
+			invalid("bit depth %d needs a high bit depth format", c.bitDepth())
+		}
+	default:
+		invalid("bit depth %d is not 8, 10 or 12", c.bitDepth())
+	}
+
+	subsampled := format&^ImageFormatHighbitdepth == ImageFormatI420 || format == ImageFormatYv12
+	if subsampled && (c.Width%2 != 0 || c.Height%2 != 0) {
+		invalid("format %v needs an even width and height, not %dx%d", format, c.Width, c.Height)
+	}
+	switch c.Codec {
+	case CodecVP8:
+		if format != ImageFormatI420 && format != ImageFormatYv12 {
+			invalid("format %v is not supported by %s, which needs I420 or YV12", format, CodecVP8)
+		}
+		if c.Profile < 0 || c.Profile > 3 {
+			invalid("profile %d out of range [0, 3]", c.Profile)
+		}
+	case CodecVP9:
+		want := 0
+		if !subsampled {
+			want = 1
+		}
+		if highBitDepth {
+			want += 2
+		}
+		if c.Profile != want {
+			invalid("format %v at bit depth %d needs profile %d, not %d", format, c.bitDepth(), want, c.Profile)
+		}
+	}
+}
+
+// validateTemporalLayers checks the temporal layers like libvpx does.
+func (c *EncoderConfig) validateTemporalLayers(invalid func(string, ...any)) {
+	layers := len(c.TemporalLayerBitrates)
+	if layers == 0 {
+		if len(c.TemporalRateDecimators) != 0 || len(c.TemporalPattern) != 0 {
+			invalid("temporal rate decimators and pattern need temporal layer bitrates")
+		}
+		return
+	}
+	if layers > TsMaxLayers {
+		invalid("%d temporal layers exceed the limit of %d", layers, TsMaxLayers)
+		return
+	}
+	if len(c.TemporalRateDecimators) != layers {
+		invalid("%d temporal rate decimators for %d temporal layers", len(c.TemporalRateDecimators), layers)
+	} else {
+		if c.TemporalRateDecimators[layers-1] != 1 {
+			invalid("top temporal layer rate decimator is %d, not 1", c.TemporalRateDecimators[layers-1])
+		}
+		for t := layers - 2; t >= 0; t-- {
+			if c.TemporalRateDecimators[t] != 2*c.TemporalRateDecimators[t+1] {
+				invalid("temporal layer %d rate decimator %d is not twice the one above", t, c.TemporalRateDecimators[t])
+			}
+		}
+	}
+	for t, kbps := range c.TemporalLayerBitrates {
+		if kbps <= 0 || (t > 0 && kbps <= c.TemporalLayerBitrates[t-1]) {
+			invalid("temporal layer %d bitrate %d is not cumulative", t, kbps)
+		}
+	}
+	if top := c.TemporalLayerBitrates[layers-1]; c.RateControl != Q && top != c.Bitrate {
+		invalid("top temporal layer bitrate %d differs from the bitrate %d", top, c.Bitrate)
+	}
+	if len(c.TemporalPattern) == 0 || len(c.TemporalPattern) > TsMaxPeriodicity {
+		invalid("temporal pattern of %d frames out of range [1, %d]", len(c.TemporalPattern), TsMaxPeriodicity)
+	}
+	for i, layer := range c.TemporalPattern {
+		if layer < 0 || layer >= layers {
+			invalid("temporal pattern frame %d is in layer %d of %d", i, layer, layers)
+		}
+	}
+}
+
+func (c *EncoderConfig) format() ImageFormat {
+	if c.Format == ImageFormatNone {
+		return ImageFormatI420
+	}
+	return c.Format
+}
+
+func (c *EncoderConfig) bitDepth() int {
+	if c.BitDepth == 0 {
+		return 8
+	}
+	return c.BitDepth
+}
+
+func (c *EncoderConfig) timebase() Rational {
+	if c.Timebase.Num == 0 || c.Timebase.Den == 0 {
+		return Rational{Num: 1, Den: 30}
+	}
+	return c.Timebase
+}
+
+func (c *EncoderConfig) frameRate() float64 {
+	if c.FrameRate > 0 {
+		return c.FrameRate
+	}
+	tb := c.timebase()
+	return float64(tb.Den) / float64(tb.Num)
+}
+
+// frames converts d to a number of frames.
+func (c *EncoderConfig) frames(d time.Duration) int {
+	return int(math.Round(d.Seconds() * c.frameRate()))
+}
+
+// duration converts a number of frames to a duration.
+func (c *EncoderConfig) duration(frames uint32) time.Duration {
+	return time.Duration(math.Round(float64(frames) / c.frameRate() * float64(time.Second)))
+}
+
+// ApplyTo writes the configuration into cfg, leaving the fields it does
+// not cover, such as the spatial layers and the two-pass statistics
+// buffer, unchanged. It does not validate the configuration.
+func (c *EncoderConfig) ApplyTo(cfg *CodecEncCfg) {
+	cfg.GW, cfg.GH = uint32(c.Width), uint32(c.Height)
+	cfg.GProfile = uint32(c.Profile)
+	cfg.GBitDepth = BitDepth(c.bitDepth())
+	cfg.GInputBitDepth = uint32(c.bitDepth())
+	cfg.GTimebase = Rational{Num: c.timebase().Num, Den: c.timebase().Den}
+	cfg.GThreads = uint32(c.Threads)
+	cfg.GLagInFrames = uint32(c.Lag)
+	cfg.GErrorResilient = c.ErrorResilient
+	cfg.GPass = c.Pass
+
+	cfg.RcEndUsage = c.RateControl
+	cfg.RcTargetBitrate = uint32(c.Bitrate)
+	cfg.RcMinQuantizer, cfg.RcMaxQuantizer = uint32(c.MinQuantizer), uint32(c.MaxQuantizer)
+	cfg.RcUndershootPct, cfg.RcOvershootPct = uint32(c.UndershootPct), uint32(c.OvershootPct)
+	cfg.RcBufSz = uint32(c.BufferSize.Milliseconds())
+	cfg.RcBufInitialSz = uint32(c.BufferInitialSize.Milliseconds())
+	cfg.RcBufOptimalSz = uint32(c.BufferOptimalSize.Milliseconds())
+	cfg.RcDropframeThresh = uint32(c.DropFrameThreshold)
+
+	cfg.KfMode = KfDisabled
+	if c.AutoKeyframes {
+		cfg.KfMode = KfAuto
+	}
+	cfg.KfMinDist = uint32(c.frames(c.KeyframeMinInterval))
+	cfg.KfMaxDist = uint32(c.frames(c.KeyframeMaxInterval))
+
+	layers := len(c.TemporalLayerBitrates)
+	cfg.TsNumberLayers = uint32(max(layers, 1))
+	cfg.TsPeriodicity = uint32(len(c.TemporalPattern))
+	cfg.TsTargetBitrate = [TsMaxLayers]uint32{}
+	cfg.TsRateDecimator = [TsMaxLayers]uint32{}
+	cfg.TsLayerID = [TsMaxPeriodicity]uint32{}
+	if layers > 0 {
+		cfg.LayerTargetBitrate = [MaxLayers]uint32{}
+	}
+	for t := 0; t < layers && t < TsMaxLayers; t++ {
+		cfg.TsTargetBitrate[t] = uint32(c.TemporalLayerBitrates[t])
+		cfg.LayerTargetBitrate[t] = uint32(c.TemporalLayerBitrates[t])
+		if t < len(c.TemporalRateDecimators) {
+			cfg.TsRateDecimator[t] = uint32(c.TemporalRateDecimators[t])
+		}
+	}
+	for i := 0; i < len(c.TemporalPattern) && i < TsMaxPeriodicity; i++ {
+		cfg.TsLayerID[i] = uint32(c.TemporalPattern[i])
+	}
+}
+
+// CodecEncCfg returns the default configuration of c.Codec with c applied,
+// for use with the low-level API, once c is valid. The caller frees it.
+// The two-pass statistics are not copied: point RcTwopassStatsIn to C
+// memory holding them for the last pass.
+func (c *EncoderConfig) CodecEncCfg() (*CodecEncCfg, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	cfg, err := defaultEncCfg(c.Codec)
+	if err != nil {
+		return nil, err
+	}
+	c.ApplyTo(cfg)
+	return cfg, nil
+}
+
+// EncoderConfigFrom returns the configuration held by cfg, an encoder
+// configuration of codec. FrameRate is left zero, so that durations are
+// counted in Timebase units, and Format is derived from the profile.
+func EncoderConfigFrom(codec Codec, cfg *CodecEncCfg) *EncoderConfig {
+	c := &EncoderConfig{
+		Codec:          codec,
+		Width:          int(cfg.GW),
+		Height:         int(cfg.GH),
+		Profile:        int(cfg.GProfile),
+		BitDepth:       int(cfg.GBitDepth),
+		Timebase:       Rational{Num: cfg.GTimebase.Num, Den: cfg.GTimebase.Den},
+		Threads:        int(cfg.GThreads),
+		Lag:            int(cfg.GLagInFrames),
+		ErrorResilient: cfg.GErrorResilient,
+		Pass:           cfg.GPass,
+
+		RateControl:        cfg.RcEndUsage,
+		Bitrate:            int(cfg.RcTargetBitrate),
+		MinQuantizer:       int(cfg.RcMinQuantizer),
+		MaxQuantizer:       int(cfg.RcMaxQuantizer),
+		UndershootPct:      int(cfg.RcUndershootPct),
+		OvershootPct:       int(cfg.RcOvershootPct),
+		BufferSize:         time.Duration(cfg.RcBufSz) * time.Millisecond,
+		BufferInitialSize:  time.Duration(cfg.RcBufInitialSz) * time.Millisecond,
+		BufferOptimalSize:  time.Duration(cfg.RcBufOptimalSz) * time.Millisecond,
+		DropFrameThreshold: int(cfg.RcDropframeThresh),
+
+		AutoKeyframes: cfg.KfMode == KfAuto,
+	}
+	if codec == CodecVP9 {
+		switch c.Profile {
+		case 1:
+			c.Format = ImageFormatI444
+		case 2:
+			c.Format = ImageFormatI42016
+		case 3:
+			c.Format = ImageFormatI44416
+		}
+	}
+	if c.Format == ImageFormatNone {
+		c.Format = ImageFormatI420
+	}
+	c.KeyframeMinInterval = c.duration(cfg.KfMinDist)
+	c.KeyframeMaxInterval = c.duration(cfg.KfMaxDist)
+
+	if layers := int(cfg.TsNumberLayers); layers >= 1 && layers <= TsMaxLayers && cfg.TsPeriodicity > 0 {
+		c.TemporalLayerBitrates = make([]int, layers)
+		c.TemporalRateDecimators = make([]int, layers)
+		for t := 0; t < layers; t++ {
+			c.TemporalLayerBitrates[t] = int(cfg.TsTargetBitrate[t])
+			c.TemporalRateDecimators[t] = int(cfg.TsRateDecimator[t])
+		}
+		for i := 0; i < int(cfg.TsPeriodicity) && i < TsMaxPeriodicity; i++ {
+			c.TemporalPattern = append(c.TemporalPattern, int(cfg.TsLayerID[i]))
+		}
+	}
+	return c
+}
+
+// Config returns the current configuration of the encoder.
+func (e *Encoder) Config() *EncoderConfig {
+	if e.ctx == nil {
+		return nil
+	}
+	c := EncoderConfigFrom(e.codec, e.cfg)
+	c.FrameRate = e.frameRate
+	if c.FrameRate > 0 {
+		// Convert the keyframe intervals at the configured frame rate.
+		c.KeyframeMinInterval = c.duration(e.cfg.KfMinDist)
+		c.KeyframeMaxInterval = c.duration(e.cfg.KfMaxDist)
+	}
+	c.Deadline = e.deadline
+	return c
+}
+
+// Reconfigure changes the configuration of a running encoder. fn edits a
+// copy of the current configuration, which is validated and applied before
+// the next frame is encoded. It suits the bitrate, quantizer range,
+// rate control buffer, keyframe and deadline settings, and the frame size.
+//
+// After a frame size change the next frame is a keyframe, and frames must
+// be passed at the new size. VP8 cannot grow beyond the size the encoder
+// was created with, and neither codec can change size while looking ahead
+// (Lag above 1). The codec, format, profile, bit depth, timebase and pass
+// cannot change, nor can the temporal layers, apart from their bitrates.
+// If libvpx rejects the new configuration, the encoder keeps the previous
+// one.
+func (e *Encoder) Reconfigure(fn func(*EncoderConfig)) error {
+	if e.ctx == nil {
+		return ErrCodecClosed
+	}
+	if fn == nil {
+		return fmt.Errorf("%w: nil reconfigure function", ErrCodecInvalidParam)
+	}
+	if e.svc {
+		return fmt.Errorf("%w: cannot reconfigure an svc encoder", ErrCodecIncapable)
+	}
+	if e.cfg.GPass != RcOnePass {
+		return fmt.Errorf("%w: cannot reconfigure a two-pass encoder", ErrCodecIncapable)
+	}
+	cur := e.Config()
+	next := *cur
+	next.TemporalLayerBitrates = slices.Clone(cur.TemporalLayerBitrates)
+	next.TemporalRateDecimators = slices.Clone(cur.TemporalRateDecimators)
+	next.TemporalPattern = slices.Clone(cur.TemporalPattern)
+	fn(&next)
+	if err := next.Validate(); err != nil {
+		return err
+	}
+	if err := cur.checkFixed(&next); err != nil {
+		return err
+	}
+
+	saved := *e.cfg
+	next.ApplyTo(e.cfg)
+	if err := codecError(e.ctx, "config set", CodecEncConfigSet(e.ctx, e.cfg)); err != nil {
+		*e.cfg = saved
+		return err
+	}
+	e.deadline = next.Deadline
+	if e.deadline == 0 {
+		e.deadline = DlGoodQuality
+	}
+	e.frameRate = next.FrameRate
+	if saved.GW != e.cfg.GW || saved.GH != e.cfg.GH {
+		e.keyframe = true
+	}
+	return nil
+}
+
+// checkFixed returns an error if next changes a setting of c that a
+// running encoder cannot change.
+func (c *EncoderConfig) checkFixed(next *EncoderConfig) error {
+	var fixed []string
+	if next.Codec != c.Codec {
+		fixed = append(fixed, "codec")
+	}
+	if next.format() != c.format() {
+		fixed = append(fixed, "format")
+	}
+	if next.Profile != c.Profile {
+		fixed = append(fixed, "profile")
+	}
+	if next.bitDepth() != c.bitDepth() {
+		fixed = append(fixed, "bit depth")
+	}
+	if tb := next.timebase(); tb.Num != c.timebase().Num || tb.Den != c.timebase().Den {
+		fixed = append(fixed, "timebase")
+	}
+	if next.Pass != c.Pass {
+		fixed = append(fixed, "pass")
+	}
+	if len(next.TemporalLayerBitrates) != len(c.TemporalLayerBitrates) ||
+		!slices.Equal(next.TemporalRateDecimators, c.TemporalRateDecimators) ||
+		!slices.Equal(next.TemporalPattern, c.TemporalPattern) {
+		fixed = append(fixed, "temporal layers")
+	}
+	if len(fixed) > 0 {
+		return fmt.Errorf("%w: cannot change the %s of a running encoder", ErrCodecInvalidParam, strings.Join(fixed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,483 @@
+package vpx
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncoderConfigValidate(t *testing.T) {
+	base := func(t *testing.T, codec Codec) *EncoderConfig {
+		t.Helper()
+		c, err := RealtimeCBR(codec, 320, 240, 500)
+		if err != nil {
+			t.Fatalf("RealtimeCBR failed: %v", err)
+		}
+		if err := c.Validate(); err != nil {
+			t.Fatalf("RealtimeCBR config is invalid: %v", err)
+		}
+		return c
+	}
+	tests := []struct {
+		name   string
+		codec  Codec
+		modify func(c *EncoderConfig)
+		want   string
+	}{
+		{"width", CodecVP8, func(c *EncoderConfig) { c.Width = 16384 }, "width 16384 out of range [1, 16383]"},
+		{"height", CodecVP9, func(c *EncoderConfig) { c.Height = 0 }, "height 0 out of range [1, 65535]"},
+		{"VP8 I444", CodecVP8, func(c *EncoderConfig) { c.Format = ImageFormatI444 }, "needs I420 or YV12"},
+		{"VP9 I444 profile 0", CodecVP9, func(c *EncoderConfig) { c.Format = ImageFormatI444 }, "needs profile 1, not 0"},
+		{"VP9 I420 profile 1", CodecVP9, func(c *EncoderConfig) { c.Profile = 1 }, "needs profile 0, not 1"},
+		{"VP9 high bit depth format", CodecVP9, func(c *EncoderConfig) { c.Format, c.Profile = ImageFormatI42016, 2 }, "needs a bit depth of 10 or 12"},
+		{"odd width", CodecVP8, func(c *EncoderConfig) { c.Width = 321 }, "needs an even width and height, not 321x240"},
+		{"odd height", CodecVP9, func(c *EncoderConfig) { c.Format, c.Height = ImageFormatYv12, 241 }, "needs an even width and height, not 320x241"},
+		{"VP8 bit depth", CodecVP8, func(c *EncoderConfig) { c.BitDepth = 10 }, "only supported by VP9"},
+		{"timebase", CodecVP8, func(c *EncoderConfig) { c.Timebase = Rational{Num: 1, Den: -30} }, "timebase 1/-30"},
+		{"lag", CodecVP9, func(c *EncoderConfig) { c.Lag = 26 }, "lag 26 out of range"},
+		{"last pass stats", CodecVP8, func(c *EncoderConfig) { c.Pass = RcLastPass }, "needs the statistics"},
+		{"one pass stats", CodecVP8, func(c *EncoderConfig) { c.TwoPassStats = []byte{1} }, "only used by the last pass"},
+		{"bitrate", CodecVP8, func(c *EncoderConfig) { c.Bitrate = 0 }, "bitrate 0 is not positive"},
+		{"quantizers", CodecVP9, func(c *EncoderConfig) { c.MinQuantizer, c.MaxQuantizer = 40, 30 }, "min quantizer 40 is above max quantizer 30"},
+		{"VP9 overshoot", CodecVP9, func(c *EncoderConfig) { c.OvershootPct = 200 }, "overshoot percentage 200 out of range [0, 100]"},
+		{"buffer levels", CodecVP8, func(c *EncoderConfig) { c.BufferInitialSize = 2 * time.Second }, "exceed the buffer size"},
+		{"drop threshold", CodecVP8, func(c *EncoderConfig) { c.DropFrameThreshold = 101 }, "drop frame threshold 101"},
+		{"VP9 keyframe min interval", CodecVP9, func(c *EncoderConfig) { c.KeyframeMinInterval = time.Second }, "keyframe min interval of zero or equal"},
+		{"keyframe intervals", CodecVP9, func(c *EncoderConfig) { c.KeyframeMinInterval, c.KeyframeMaxInterval = 2*time.Second, time.Second }, "exceeds the max interval"},
+		{"too many temporal layers", CodecVP8, func(c *EncoderConfig) {
+			c.TemporalLayerBitrates = []int{100, 200, 300, 400, 500, 600}
+		}, "6 temporal layers exceed the limit of 5"},
+		{"temporal decimators", CodecVP8, func(c *EncoderConfig) {
+			c.TemporalLayerBitrates, c.TemporalRateDecimators, c.TemporalPattern = []int{300, 500}, []int{3, 1}, []int{0, 1}
+		}, "rate decimator 3 is not twice the one above"},
+		{"temporal bitrates", CodecVP8, func(c *EncoderConfig) {
+			c.TemporalLayerBitrates, c.TemporalRateDecimators, c.TemporalPattern = []int{500, 500}, []int{2, 1}, []int{0, 1}
+		}, "temporal layer 1 bitrate 500 is not cumulative"},
+		{"temporal top bitrate", CodecVP8, func(c *EncoderConfig) {
+			c.TemporalLayerBitrates, c.TemporalRateDecimators, c.TemporalPattern = []int{200, 400}, []int{2, 1}, []int{0, 1}
+		}, "top temporal layer bitrate 400 differs from the bitrate 500"},
+		{"temporal pattern", CodecVP8, func(c *EncoderConfig) {
+			c.TemporalLayerBitrates, c.TemporalRateDecimators, c.TemporalPattern = []int{300, 500}, []int{2, 1}, []int{0, 2}
+		}, "temporal pattern frame 1 is in layer 2 of 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := base(t, tt.codec)
+			tt.modify(c)
+			err := c.Validate()
+			if !errors.Is(err, ErrCodecInvalidParam) {
+				t.Fatalf("Validate = %v, want ErrCodecInvalidParam", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate = %q, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+
+	// VP8 places automatic keyframes at any distance within the bounds.
+	c := base(t, CodecVP8)
+	c.KeyframeMinInterval = time.Second
+	if err := c.Validate(); err != nil {
+		t.Errorf("VP8 keyframe min interval: %v", err)
+	}
+	// Only 4:2:0 formats need even sizes.
+	c = base(t, CodecVP9)
+	c.Format, c.Profile, c.Width, c.Height = ImageFormatI444, 1, 321, 241
+	if err := c.Validate(); err != nil {
+		t.Errorf("321x241 I444: %v", err)
+	}
+
+	// Every problem is reported at once.
+	c.Width, c.Bitrate, c.Lag = 0, 0, 30
+	msg := c.Validate().Error()
+	for _, want := range []string{"width 0", "bitrate 0", "lag 30"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Validate = %q, want it to mention %q", msg, want)
+		}
+	}
+}
+
+func TestEncoderConfigConversion(t *testing.T) {
+	vp8, err := RealtimeCBR(CodecVP8, 640, 360, 800)
+	if err != nil {
+		t.Fatalf("RealtimeCBR failed: %v", err)
+	}
+	vp8.ErrorResilient = ErrorResilientDefault
+	vp8.TemporalLayerBitrates = []int{200, 400, 800}
+	vp8.TemporalRateDecimators = []int{4, 2, 1}
+	vp8.TemporalPattern = []int{0, 2, 1, 2}
+	vod, err := VODTwoPass(CodecVP9, 1280, 720, 2000)
+	if err != nil {
+		t.Fatalf("VODTwoPass failed: %v", err)
+	}
+	vod.Timebase = Rational{Num: 1, Den: 1000}
+	vod.FrameRate = 25
+	lossless, err := Lossless(320, 240)
+	if err != nil {
+		t.Fatalf("Lossless failed: %v", err)
+	}
+	oneLayer, err := RealtimeCBR(CodecVP9, 320, 240, 300)
+	if err != nil {
+		t.Fatalf("RealtimeCBR failed: %v", err)
+	}
+	oneLayer.TemporalLayerBitrates = []int{300}
+	oneLayer.TemporalRateDecimators = []int{1}
+	oneLayer.TemporalPattern = []int{0}
+
+	for _, c := range []*EncoderConfig{vp8, vod, lossless, oneLayer} {
+		cfg, err := c.CodecEncCfg()
+		if err != nil {
+			t.Fatalf("%s: CodecEncCfg failed: %v", c.Codec, err)
+		}
+		got := EncoderConfigFrom(c.Codec, cfg)
+		cfg.Free()
+		if c == vod {
+			// Without a frame rate, durations come back in timebase units.
+			if want := int(5 * 25); int(got.KeyframeMaxInterval/time.Millisecond) != want {
+				t.Errorf("VP9 keyframe max interval = %v, want %d frames of 1ms", got.KeyframeMaxInterval, want)
+			}
+			got.KeyframeMaxInterval, got.FrameRate = c.KeyframeMaxInterval, c.FrameRate
+		}
+		got.Deadline = c.Deadline
+		if !reflect.DeepEqual(got, c) {
+			t.Errorf("%s: round trip = %+v, want %+v", c.Codec, got, c)
+		}
+	}
+	if _, err := (&EncoderConfig{Codec: CodecVP8}).CodecEncCfg(); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("CodecEncCfg of an invalid config = %v, want ErrCodecInvalidParam", err)
+	}
+}
+
+func TestEncoderConfigRealtimeCBR(t *testing.T) {
+	for _, codec := range []Codec{CodecVP8, CodecVP9} {
+		c, err := RealtimeCBR(codec, 320, 240, 300)
+		if err != nil {
+			t.Fatalf("RealtimeCBR failed: %v", err)
+		}
+		enc, err := NewEncoder(codec, EncoderOptions{Config: c})
+		if err != nil {
+			t.Fatalf("%s: NewEncoder failed: %v", codec, err)
+		}
+		if enc.deadline != DlRealtime {
+			t.Errorf("%s: deadline = %d, want DlRealtime", codec, enc.deadline)
+		}
+		img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+		img.Deref()
+		for i := 0; i < 3; i++ {
+			fillTestPattern(img, i)
+			// Without lookahead, every frame comes out at once.
+			if pkts, err := enc.Encode(img, CodecPts(i), 0); err != nil || len(pkts) != 1 {
+				t.Errorf("%s: Encode frame %d = %d packets, %v", codec, i, len(pkts), err)
+			}
+		}
+		ImageFree(img)
+		enc.Close()
+	}
+
+	c, err := RealtimeCBR(CodecVP8, 20000, 240, 300)
+	if err != nil {
+		t.Fatalf("RealtimeCBR failed: %v", err)
+	}
+	var opErr *CodecOpError
+	if _, err := NewEncoder(CodecVP8, EncoderOptions{Config: c}); !errors.Is(err, ErrCodecInvalidParam) || errors.As(err, &opErr) {
+		t.Errorf("NewEncoder with an invalid config = %v, want a validation error", err)
+	}
+	c.Width = 320
+	if _, err := NewEncoder(CodecVP9, EncoderOptions{Config: c}); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("NewEncoder with a VP8 config for VP9 = %v, want ErrCodecInvalidParam", err)
+	}
+}
+
+func TestEncoderConfigLossless(t *testing.T) {
+	c, err := Lossless(320, 240)
+	if err != nil {
+		t.Fatalf("Lossless failed: %v", err)
+	}
+	enc, err := NewEncoder(CodecVP9, EncoderOptions{Config: c})
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	defer enc.Close()
+	dec, err := NewDecoder(CodecVP9, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer dec.Close()
+
+	img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+	defer ImageFree(img)
+	img.Deref()
+	var inputs []*Image
+	var packets []Packet
+	for i := 0; i < 3; i++ {
+		fillNoise(img, int64(i))
+		inputs = append(inputs, cloneImage(img))
+		pkts, err := enc.Encode(img, CodecPts(i), 0)
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		packets = append(packets, pkts...)
+	}
+	pkts, err := enc.Flush()
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	var decoded int
+	for _, p := range append(packets, pkts...) {
+		frames, err := dec.Decode(p.Data)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		for _, f := range frames {
+			if !equalImages(f.Image(), inputs[decoded]) {
+				t.Errorf("lossless frame %d differs from its input", decoded)
+			}
+			decoded++
+		}
+	}
+	if decoded != len(inputs) {
+		t.Errorf("decoded %d frames, want %d", decoded, len(inputs))
+	}
+}
+
+func TestEncoderConfigVODTwoPass(t *testing.T) {
+	const frames = 10
+	img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+	defer ImageFree(img)
+	img.Deref()
+	encodeAll := func(c *EncoderConfig) (*Encoder, []Packet) {
+		t.Helper()
+		enc, err := NewEncoder(CodecVP8, EncoderOptions{Config: c})
+		if err != nil {
+			t.Fatalf("NewEncoder(%v) failed: %v", c.Pass, err)
+		}
+		var packets []Packet
+		for i := 0; i < frames; i++ {
+			fillTestPattern(img, i)
+			pkts, err := enc.Encode(img, CodecPts(i), 0)
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			packets = append(packets, pkts...)
+		}
+		pkts, err := enc.Flush()
+		if err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+		return enc, append(packets, pkts...)
+	}
+
+	c, err := VODTwoPass(CodecVP8, 320, 240, 400)
+	if err != nil {
+		t.Fatalf("VODTwoPass failed: %v", err)
+	}
+	first, packets := encodeAll(c)
+	stats := first.TwoPassStats()
+	first.Close()
+	if len(packets) != 0 || len(stats) == 0 {
+		t.Fatalf("first pass produced %d packets and %d bytes of statistics", len(packets), len(stats))
+	}
+
+	c.Pass, c.TwoPassStats = RcLastPass, stats
+	last, packets := encodeAll(c)
+	defer last.Close()
+	if len(packets) != frames || len(last.TwoPassStats()) != 0 {
+		t.Fatalf("last pass produced %d packets and %d bytes of statistics, want %d packets", len(packets), len(last.TwoPassStats()), frames)
+	}
+	dec, err := NewDecoder(CodecVP8, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer dec.Close()
+	for i, p := range packets {
+		if got, err := dec.Decode(p.Data); err != nil || len(got) != 1 {
+			t.Errorf("frame %d: decode = %d frames, %v", i, len(got), err)
+		}
+	}
+}
+
+func TestEncoderReconfigureResolution(t *testing.T) {
+	type size struct{ w, h int }
+	for _, tc := range []struct {
+		codec Codec
+		sizes []size
+	}{
+		{CodecVP8, []size{{320, 240}, {160, 120}, {320, 240}}},
+		// VP9 can also grow beyond the size it was created with.
+		{CodecVP9, []size{{320, 240}, {160, 120}, {640, 480}, {320, 240}}},
+	} {
+		t.Run(tc.codec.String(), func(t *testing.T) {
+			c, err := RealtimeCBR(tc.codec, 320, 240, 300)
+			if err != nil {
+				t.Fatalf("RealtimeCBR failed: %v", err)
+			}
+			enc, err := NewEncoder(tc.codec, EncoderOptions{Config: c})
+			if err != nil {
+				t.Fatalf("NewEncoder failed: %v", err)
+			}
+			defer enc.Close()
+			dec, err := NewDecoder(tc.codec, DecoderOptions{})
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			defer dec.Close()
+
+			var pts CodecPts
+			for i, s := range tc.sizes {
+				if i > 0 {
+					err := enc.Reconfigure(func(c *EncoderConfig) {
+						c.Width, c.Height = s.w, s.h
+					})
+					if err != nil {
+						t.Fatalf("Reconfigure to %dx%d failed: %v", s.w, s.h, err)
+					}
+				}
+				if got := enc.Config(); got.Width != s.w || got.Height != s.h {
+					t.Errorf("Config size = %dx%d, want %dx%d", got.Width, got.Height, s.w, s.h)
+				}
+				img := ImageAlloc(nil, ImageFormatI420, uint32(s.w), uint32(s.h), 1)
+				defer ImageFree(img)
+				img.Deref()
+				for j := 0; j < 3; j++ {
+					fillTestPattern(img, int(pts))
+					pkts, err := enc.Encode(img, pts, 0)
+					if err != nil || len(pkts) != 1 {
+						t.Fatalf("Encode %dx%d frame %d = %d packets, %v", s.w, s.h, j, len(pkts), err)
+					}
+					pts++
+					// Only the first frame and the first frame after each
+					// size change are keyframes.
+					if key := pkts[0].IsKeyframe(); key != (j == 0) {
+						t.Errorf("%dx%d frame %d keyframe = %v, want %v", s.w, s.h, j, key, j == 0)
+					}
+					frames, err := dec.Decode(pkts[0].Data)
+					if err != nil || len(frames) != 1 {
+						t.Fatalf("Decode %dx%d frame %d = %d frames, %v", s.w, s.h, j, len(frames), err)
+					}
+					if got := frames[0]; got.Width() != s.w || got.Height() != s.h {
+						t.Errorf("decoded %dx%d, want %dx%d", got.Width(), got.Height(), s.w, s.h)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncoderReconfigureVP8Grow(t *testing.T) {
+	enc := newRealtimeEncoder(t, CodecVP8)
+	err := enc.Reconfigure(func(c *EncoderConfig) {
+		c.Width, c.Height = 640, 480
+	})
+	var opErr *CodecOpError
+	if !errors.As(err, &opErr) || !errors.Is(err, ErrCodecInvalidParam) {
+		t.Fatalf("Reconfigure beyond the initial size = %v, want a CodecOpError", err)
+	}
+	if !strings.Contains(opErr.Detail, "width or height") {
+		t.Errorf("error detail = %q, want the libvpx explanation", opErr.Detail)
+	}
+	// The encoder keeps its size and goes on encoding.
+	if got := enc.Config(); got.Width != 320 || got.Height != 240 {
+		t.Errorf("Config size = %dx%d after a failed Reconfigure, want 320x240", got.Width, got.Height)
+	}
+	for i := 0; i < 2; i++ {
+		encodeOneFrame(t, enc, CodecPts(i))
+	}
+}
+
+func TestEncoderReconfigureRateControl(t *testing.T) {
+	for _, codec := range []Codec{CodecVP8, CodecVP9} {
+		t.Run(codec.String(), func(t *testing.T) {
+			c, err := RealtimeCBR(codec, 320, 240, 300)
+			if err != nil {
+				t.Fatalf("RealtimeCBR failed: %v", err)
+			}
+			// Every frame must come out, even at 100 kbps.
+			c.DropFrameThreshold = 0
+			enc, err := NewEncoder(codec, EncoderOptions{Config: c})
+			if err != nil {
+				t.Fatalf("NewEncoder failed: %v", err)
+			}
+			defer enc.Close()
+			if err := enc.Reconfigure(nil); !errors.Is(err, ErrCodecInvalidParam) {
+				t.Errorf("Reconfigure(nil) = %v, want ErrCodecInvalidParam", err)
+			}
+			img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+			defer ImageFree(img)
+			img.Deref()
+			for i := 0; i < 6; i++ {
+				if i == 3 {
+					err := enc.Reconfigure(func(c *EncoderConfig) {
+						c.Bitrate = 100
+						c.MinQuantizer, c.MaxQuantizer = 40, 50
+					})
+					if err != nil {
+						t.Fatalf("Reconfigure failed: %v", err)
+					}
+					got := enc.Config()
+					if got.Bitrate != 100 || got.MinQuantizer != 40 || got.MaxQuantizer != 50 {
+						t.Errorf("Config = %d kbps, quantizer %d..%d, want 100 kbps, 40..50",
+							got.Bitrate, got.MinQuantizer, got.MaxQuantizer)
+					}
+					if got.Deadline != DlRealtime || got.BufferSize != c.BufferSize {
+						t.Error("Reconfigure changed the deadline or buffer size")
+					}
+				}
+				fillTestPattern(img, i)
+				pkts, err := enc.Encode(img, CodecPts(i), 0)
+				if err != nil || len(pkts) != 1 {
+					t.Fatalf("Encode frame %d = %d packets, %v", i, len(pkts), err)
+				}
+				if i > 0 && pkts[0].IsKeyframe() {
+					t.Errorf("frame %d is a keyframe", i)
+				}
+				if i >= 3 {
+					q, err := enc.LastQuantizer64()
+					if err != nil {
+						t.Fatalf("LastQuantizer64 failed: %v", err)
+					}
+					if q < 40 || q > 50 {
+						t.Errorf("frame %d quantizer = %d, want 40..50", i, q)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncoderReconfigureErrors(t *testing.T) {
+	enc := newRealtimeEncoder(t, CodecVP9)
+	want := enc.Config()
+	for _, tc := range []struct {
+		name string
+		fn   func(*EncoderConfig)
+	}{
+		{"invalid", func(c *EncoderConfig) { c.MaxQuantizer = 64 }},
+		{"codec", func(c *EncoderConfig) { c.Codec = CodecVP8 }},
+		{"timebase", func(c *EncoderConfig) { c.Timebase = Rational{Num: 1, Den: 1000} }},
+		{"pass", func(c *EncoderConfig) { c.Pass = RcFirstPass }},
+		{"temporal layers", func(c *EncoderConfig) {
+			c.TemporalLayerBitrates = []int{c.Bitrate / 2, c.Bitrate}
+			c.TemporalRateDecimators = []int{2, 1}
+			c.TemporalPattern = []int{0, 1}
+		}},
+	} {
+		if err := enc.Reconfigure(tc.fn); !errors.Is(err, ErrCodecInvalidParam) {
+			t.Errorf("%s: Reconfigure = %v, want ErrCodecInvalidParam", tc.name, err)
+		}
+	}
+	if got := enc.Config(); !reflect.DeepEqual(got, want) {
+		t.Errorf("rejected changes altered the config:\n got %+v\nwant %+v", got, want)
+	}
+
+	svc := newSVCEncoder(t, NewSVCConfig(2, 1).SetBitrate(0, 0, 100).SetBitrate(1, 0, 300))
+	if err := svc.Reconfigure(func(*EncoderConfig) {}); !errors.Is(err, ErrCodecIncapable) {
+		t.Errorf("svc: Reconfigure = %v, want ErrCodecIncapable", err)
+	}
+
+	enc.Close()
+	if err := enc.Reconfigure(func(*EncoderConfig) {}); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("closed: Reconfigure = %v, want ErrCodecClosed", err)
+	}
+}
@@ -0,0 +1,589 @@
+package vpx
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// controlInt applies an int-valued control, reporting failures with the
+// libvpx error detail.
+func (e *Encoder) controlInt(op string, ctrlID int, value int) error {
+	if e.ctx == nil {
+		return ErrCodecClosed
+	}
+	return codecError(e.ctx, op, CodecControlInt(e.ctx, ctrlID, value))
+}
+
+// controlUint applies an unsigned int-valued control, reporting failures with
+// the libvpx error detail.
+func (e *Encoder) controlUint(op string, ctrlID int, value uint32) error {
+	if e.ctx == nil {
+		return ErrCodecClosed
+	}
+	return codecError(e.ctx, op, CodecControlUint(e.ctx, ctrlID, value))
+}
+
+// requireCodec rejects controls that libvpx only implements for codec.
+func (e *Encoder) requireCodec(codec Codec, op string) error {
+	if e.codec != codec {
+		return fmt.Errorf("%w: %s is only supported by %s", ErrCodecIncapable, op, codec)
+	}
+	return nil
+}
+
+func checkRange(op string, value, min, max int) error {
+	if value < min || value > max {
+		return fmt.Errorf("%w: %s %d out of range [%d, %d]", ErrCodecInvalidParam, op, value, min, max)
+	}
+	return nil
+}
+
+// SetCPUUsed sets the speed/quality trade-off. Higher values are faster.
+// The valid range is -16..16 for VP8 and -9..9 for VP9.
+func (e *Encoder) SetCPUUsed(cpuUsed int) error {
+	max := 16
+	if e.codec == CodecVP9 {
+		max = 9
+	}
+	if err := checkRange("cpu used", cpuUsed, -max, max); err != nil {
+		return err
+	}
+	return e.controlInt("set cpu used", VP8ESetCPUUsed, cpuUsed)
+}
+
+// SetAutoAltRef enables automatic alternate reference frames. VP8 accepts
+// 0 or 1; VP9 accepts 0..6, the number of alt-ref layers.
+func (e *Encoder) SetAutoAltRef(layers int) error {
+	max := 1
+	if e.codec == CodecVP9 {
+		max = 6
+	}
+	if err := checkRange("auto alt ref", layers, 0, max); err != nil {
+		return err
+	}
+	return e.controlUint("set auto alt ref", VP8ESetEnableAutoAltRef, uint32(layers))
+}
+
+// SetNoiseSensitivity sets the temporal denoiser strength, 0 (off) to 6.
+func (e *Encoder) SetNoiseSensitivity(sensitivity int) error {
+	if err := checkRange("noise sensitivity", sensitivity, 0, 6); err != nil {
+		return err
+	}
+	ctrlID := VP8ESetNoiseSensitivity
+	if e.codec == CodecVP9 {
+		ctrlID = VP9ESetNoiseSensitivity
+	}
+	return e.controlUint("set noise sensitivity", ctrlID, uint32(sensitivity))
+}
+
+// SetSharpness trades PSNR for sharpness, 0..7.
+func (e *Encoder) SetSharpness(sharpness int) error {
+	if err := checkRange("sharpness", sharpness, 0, 7); err != nil {
+		return err
+	}
+	return e.controlUint("set sharpness", VP8ESetSharpness, uint32(sharpness))
+}
+
+// SetStaticThreshold sets the threshold below which macroblocks are treated as static.
+func (e *Encoder) SetStaticThreshold(threshold uint32) error {
+	return e.controlUint("set static threshold", VP8ESetStaticThreshold, threshold)
+}
+
+// SetTokenPartitions sets the number of VP8 token partitions.
+func (e *Encoder) SetTokenPartitions(partitions TokenPartitions) error {
+	if err := e.requireCodec(CodecVP8, "token partitions"); err != nil {
+		return err
+	}
+	if err := checkRange("token partitions", int(partitions), int(OneTokenPartition), int(EightTokenPartitions)); err != nil {
+		return err
+	}
+	return e.controlInt("set token partitions", VP8ESetTokenPartitions, int(partitions))
+}
+
+// SetARNRMaxFrames sets the maximum number of frames used to build an alt-ref, 0..15.
+func (e *Encoder) SetARNRMaxFrames(frames int) error {
+	if err := checkRange("arnr max frames", frames, 0, 15); err != nil {
+		return err
+	}
+	return e.controlUint("set arnr max frames", VP8ESetARNRMaxFrames, uint32(frames))
+}
+
+// SetARNRStrength sets the alt-ref temporal filter strength, 0..6.
+func (e *Encoder) SetARNRStrength(strength int) error {
+	if err := checkRange("arnr strength", strength, 0, 6); err != nil {
+		return err
+	}
+	return e.controlUint("set arnr strength", VP8ESetARNRStrength, uint32(strength))
+}
+
+// SetARNRType sets the alt-ref temporal filter type, 1..3.
+//
+// Deprecated: libvpx ignores this control for VP9 and it is slated for removal.
+func (e *Encoder) SetARNRType(filterType int) error {
+	if err := checkRange("arnr type", filterType, 1, 3); err != nil {
+		return err
+	}
+	return e.controlUint("set arnr type", VP8ESetARNRType, uint32(filterType))
+}
+
+// SetTuning selects the metric the encoder optimizes for.
+func (e *Encoder) SetTuning(tuning Tuning) error {
+	if err := checkRange("tuning", int(tuning), int(TunePSNR), int(TuneSSIM)); err != nil {
+		return err
+	}
+	return e.controlInt("set tuning", VP8ESetTuning, int(tuning))
+}
+
+// SetCQLevel sets the constrained/constant quality level, 0..63.
+// It only takes effect with the Cq and Q rate control modes.
+func (e *Encoder) SetCQLevel(level int) error {
+	if err := checkRange("cq level", level, 0, 63); err != nil {
+		return err
+	}
+	return e.controlUint("set cq level", VP8ESetCQLevel, uint32(level))
+}
+
+// SetMaxIntraBitratePct caps keyframe size as a percentage of the average
+// per-frame bitrate. 0 means unlimited.
+func (e *Encoder) SetMaxIntraBitratePct(pct uint32) error {
+	return e.controlUint("set max intra bitrate pct", VP8ESetMaxIntraBitratePct, pct)
+}
+
+// SetFrameFlags sets the reference and update flags used for the following
+// VP8 frames.
+func (e *Encoder) SetFrameFlags(flags EncFrameFlags) error {
+	if err := e.requireCodec(CodecVP8, "frame flags"); err != nil {
+		return err
+	}
+	if flags < 0 {
+		return fmt.Errorf("%w: frame flags %#x are negative", ErrCodecInvalidParam, int(flags))
+	}
+	return e.controlInt("set frame flags", VP8ESetFrameFlags, int(flags))
+}
+
+// SetTemporalLayerID sets the temporal layer of the next VP8 frame.
+// It must be below the configured number of temporal layers.
+func (e *Encoder) SetTemporalLayerID(layerID int) error {
+	if err := e.requireCodec(CodecVP8, "temporal layer id"); err != nil {
+		return err
+	}
+	if err := checkRange("temporal layer id", layerID, 0, TsMaxLayers-1); err != nil {
+		return err
+	}
+	return e.controlInt("set temporal layer id", VP8ESetTemporalLayerID, layerID)
+}
+
+// SetScreenContentMode tunes VP8 for screen content.
+func (e *Encoder) SetScreenContentMode(mode ScreenContentMode) error {
+	if err := e.requireCodec(CodecVP8, "screen content mode"); err != nil {
+		return err
+	}
+	if err := checkRange("screen content mode", int(mode), int(ScreenContentOff), int(ScreenContentAggressive)); err != nil {
+		return err
+	}
+	return e.controlUint("set screen content mode", VP8ESetScreenContentMode, uint32(mode))
+}
+
+// SetGFCBRBoostPct sets the golden frame boost in CBR mode as a percentage of
+// the average per-frame bitrate. 0 disables the boost.
+func (e *Encoder) SetGFCBRBoostPct(pct uint32) error {
+	ctrlID := VP8ESetGFCBRBoostPct
+	if e.codec == CodecVP9 {
+		ctrlID = VP9ESetGFCBRBoostPct
+	}
+	return e.controlUint("set gf cbr boost pct", ctrlID, pct)
+}
+
+// SetRTCExternalRateControl tells the encoder that an external rate
+// controller drives it in real-time mode.
+func (e *Encoder) SetRTCExternalRateControl(enable bool) error {
+	ctrlID := VP8ESetRTCExternalRatectrl
+	if e.codec == CodecVP9 {
+		ctrlID = VP9ESetRTCExternalRatectrl
+	}
+	return e.controlInt("set rtc external ratectrl", ctrlID, boolToInt(enable))
+}
+
+// SetLossless switches VP9 to lossless coding.
+func (e *Encoder) SetLossless(enable bool) error {
+	if err := e.requireCodec(CodecVP9, "lossless"); err != nil {
+		return err
+	}
+	return e.controlUint("set lossless", VP9ESetLossless, uint32(boolToInt(enable)))
+}
+
+// SetAQMode selects the VP9 adaptive quantization mode.
+func (e *Encoder) SetAQMode(mode AQMode) error {
+	if err := e.requireCodec(CodecVP9, "aq mode"); err != nil {
+		return err
+	}
+	if err := checkRange("aq mode", int(mode), int(AQOff), int(AQEquator360)); err != nil {
+		return err
+	}
+	return e.controlUint("set aq mode", VP9ESetAQMode, uint32(mode))
+}
+
+// SetTuneContent tells the VP9 encoder what kind of content it encodes.
+func (e *Encoder) SetTuneContent(content TuneContent) error {
+	if err := e.requireCodec(CodecVP9, "tune content"); err != nil {
+		return err
+	}
+	if err := checkRange("tune content", int(content), int(ContentDefault), int(ContentFilm)); err != nil {
+		return err
+	}
+	return e.controlInt("set tune content", VP9ESetTuneContent, int(content))
+}
+
+// SetFramePeriodicBoost enables periodically lowering the frame Q in VP9.
+func (e *Encoder) SetFramePeriodicBoost(enable bool) error {
+	if err := e.requireCodec(CodecVP9, "frame periodic boost"); err != nil {
+		return err
+	}
+	return e.controlUint("set frame periodic boost", VP9ESetFramePeriodicBoost, uint32(boolToInt(enable)))
+}
+
+// maxGFInterval is the largest golden frame interval libvpx accepts
+// (MAX_LAG_BUFFERS - 1).
+const maxGFInterval = 24
+
+// SetMinGFInterval sets the minimum distance between VP9 golden/alt-ref
+// frames, 0..24. Zero lets the encoder choose.
+func (e *Encoder) SetMinGFInterval(interval int) error {
+	if err := e.requireCodec(CodecVP9, "min gf interval"); err != nil {
+		return err
+	}
+	if err := checkRange("min gf interval", interval, 0, maxGFInterval); err != nil {
+		return err
+	}
+	return e.controlUint("set min gf interval", VP9ESetMinGFInterval, uint32(interval))
+}
+
+// SetMaxGFInterval sets the maximum distance between VP9 golden/alt-ref
+// frames, 0..24. Zero lets the encoder choose; otherwise it must not be
+// below the minimum interval, and GLagInFrames must be 0 or at least
+// interval+2.
+func (e *Encoder) SetMaxGFInterval(interval int) error {
+	if err := e.requireCodec(CodecVP9, "max gf interval"); err != nil {
+		return err
+	}
+	if err := checkRange("max gf interval", interval, 0, maxGFInterval); err != nil {
+		return err
+	}
+	return e.controlUint("set max gf interval", VP9ESetMaxGFInterval, uint32(interval))
+}
+
+// SetTargetLevel constrains the VP9 stream to level.
+func (e *Encoder) SetTargetLevel(level Level) error {
+	if err := e.requireCodec(CodecVP9, "target level"); err != nil {
+		return err
+	}
+	if level != LevelStatsOnly && level != LevelOff && level.String() == "" {
+		return fmt.Errorf("%w: target level %d is not a VP9 level", ErrCodecInvalidParam, int(level))
+	}
+	return e.controlUint("set target level", VP9ESetTargetLevel, uint32(level))
+}
+
+// SetDeltaQUV offsets the VP9 chroma quantizer from the luma one, -15..15.
+func (e *Encoder) SetDeltaQUV(delta int) error {
+	if err := e.requireCodec(CodecVP9, "delta q uv"); err != nil {
+		return err
+	}
+	if err := checkRange("delta q uv", delta, -15, 15); err != nil {
+		return err
+	}
+	return e.controlInt("set delta q uv", VP9ESetDeltaQUV, delta)
+}
+
+// SetAltRefAQ enables VP9 adaptive quantization of alt-ref frames. It can be
+// combined with SetAQMode.
+func (e *Encoder) SetAltRefAQ(enable bool) error {
+	if err := e.requireCodec(CodecVP9, "alt ref aq"); err != nil {
+		return err
+	}
+	return e.controlInt("set alt ref aq", VP9ESetAltRefAQ, boolToInt(enable))
+}
+
+// SetKeyFrameFiltering enables VP9 temporal filtering of keyframes.
+func (e *Encoder) SetKeyFrameFiltering(enable bool) error {
+	if err := e.requireCodec(CodecVP9, "key frame filtering"); err != nil {
+		return err
+	}
+	return e.controlInt("set key frame filtering", VP9ESetKeyFrameFiltering, boolToInt(enable))
+}
+
+// SetPostencodeDrop allows VP9 to drop a frame after it has been encoded.
+func (e *Encoder) SetPostencodeDrop(enable bool) error {
+	if err := e.requireCodec(CodecVP9, "postencode drop"); err != nil {
+		return err
+	}
+	return e.controlUint("set postencode drop", VP9ESetPostencodeDrop, uint32(boolToInt(enable)))
+}
+
+// SetQuantizerOnePass sets the quantizer, 0..63, of the next VP9 frame.
+// It disables cyclic refresh and only applies to one-pass encoding without
+// spatial layers.
+func (e *Encoder) SetQuantizerOnePass(q int) error {
+	if err := e.requireCodec(CodecVP9, "quantizer one pass"); err != nil {
+		return err
+	}
+	if err := checkRange("quantizer one pass", q, 0, 63); err != nil {
+		return err
+	}
+	return e.controlInt("set quantizer one pass", VP9ESetQuantizerOnePass, q)
+}
+
+// SetScalingMode lowers the internal coding resolution of the following
+// frames to the given horizontal and vertical ratios without reinitializing
+// the encoder. VP8 restarts with a keyframe and keeps signalling the
+// configured size; VP9 codes frames at the reduced size and reports the
+// configured size as the render size (Image.RW and Image.RH).
+func (e *Encoder) SetScalingMode(h, v ScalingMode) error {
+	if err := checkRange("horizontal scaling mode", int(h), int(ScalingNormal), int(ScalingOneTwo)); err != nil {
+		return err
+	}
+	if err := checkRange("vertical scaling mode", int(v), int(ScalingNormal), int(ScalingOneTwo)); err != nil {
+		return err
+	}
+	if e.ctx == nil {
+		return ErrCodecClosed
+	}
+	return codecError(e.ctx, "set scaling mode", CodecControlScalingMode(e.ctx, VP8ESetScaleMode, h, v))
+}
+
+// SetSVCLayerID sets the spatial and temporal layers of the next VP9 SVC
+// superframe. With TemporalLayeringBypass it must be called before every
+// Encode.
+func (e *Encoder) SetSVCLayerID(id SVCLayerID) error {
+	if err := e.requireCodec(CodecVP9, "svc layer id"); err != nil {
+		return err
+	}
+	if e.ctx == nil {
+		return ErrCodecClosed
+	}
+	spatial, temporal := int(e.cfg.SsNumberLayers), int(e.cfg.TsNumberLayers)
+	if err := checkRange("svc spatial layer id", id.SpatialLayerID, 0, spatial-1); err != nil {
+		return err
+	}
+	if err := checkRange("svc temporal layer id", id.TemporalLayerID, 0, temporal-1); err != nil {
+		return err
+	}
+	for _, t := range id.TemporalLayerIDs[:spatial] {
+		if err := checkRange("svc temporal layer id", t, 0, temporal-1); err != nil {
+			return err
+		}
+	}
+	return codecError(e.ctx, "set svc layer id", CodecControlSVCLayerID(e.ctx, id))
+}
+
+// SVCLayerID returns the layers of the last encoded VP9 SVC superframe.
+func (e *Encoder) SVCLayerID() (SVCLayerID, error) {
+	if err := e.requireCodec(CodecVP9, "svc layer id"); err != nil {
+		return SVCLayerID{}, err
+	}
+	if e.ctx == nil {
+		return SVCLayerID{}, ErrCodecClosed
+	}
+	id, err := CodecControlGetSVCLayerID(e.ctx)
+	return id, codecError(e.ctx, "get svc layer id", err)
+}
+
+// SetSVCRefFrameConfig sets the reference buffers of each spatial layer of
+// the next VP9 SVC superframe. It requires TemporalLayeringBypass.
+func (e *Encoder) SetSVCRefFrameConfig(c *SVCRefFrameConfig) error {
+	if err := e.requireCodec(CodecVP9, "svc ref frame config"); err != nil {
+		return err
+	}
+	if c == nil {
+		return fmt.Errorf("%w: nil svc ref frame config", ErrCodecInvalidParam)
+	}
+	if e.ctx == nil {
+		return ErrCodecClosed
+	}
+	for s := 0; s < SsMaxLayers; s++ {
+		for _, idx := range []int{c.LastIdx[s], c.GoldenIdx[s], c.AltRefIdx[s]} {
+			if err := checkRange("svc reference buffer", idx, 0, 7); err != nil {
+				return err
+			}
+		}
+		if err := checkRange("svc update buffer slot", c.UpdateBufferSlot[s], 0, 0xff); err != nil {
+			return err
+		}
+	}
+	return codecError(e.ctx, "set svc ref frame config", CodecControlSVCRefFrameConfig(e.ctx, c))
+}
+
+// controlIntPtr reads back an int-valued control.
+func (e *Encoder) controlIntPtr(op string, ctrlID int) (int, error) {
+	if e.ctx == nil {
+		return 0, ErrCodecClosed
+	}
+	value, err := CodecControlIntPtr(e.ctx, ctrlID)
+	if err := codecError(e.ctx, op, err); err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+// LastQuantizer returns the quantizer chosen for the last encoded frame, on
+// libvpx's internal 0..255 (VP9) or 0..127 (VP8) scale.
+func (e *Encoder) LastQuantizer() (int, error) {
+	return e.controlIntPtr("get last quantizer", VP8EGetLastQuantizer)
+}
+
+// LastQuantizer64 returns the quantizer chosen for the last encoded frame on
+// the 0..63 scale used by RcMinQuantizer and RcMaxQuantizer.
+func (e *Encoder) LastQuantizer64() (int, error) {
+	return e.controlIntPtr("get last quantizer 64", VP8EGetLastQuantizer64)
+}
+
+// Level returns the VP9 level the stream encoded so far conforms to.
+// libvpx only tracks it when SetTargetLevel was given a value other than
+// LevelOff; otherwise Level returns LevelStatsOnly.
+func (e *Encoder) Level() (Level, error) {
+	if err := e.requireCodec(CodecVP9, "level"); err != nil {
+		return 0, err
+	}
+	level, err := e.controlIntPtr("get level", VP9EGetLevel)
+	return Level(level), err
+}
+
+// LoopFilterLevel returns the VP9 loop filter level of the last encoded frame.
+func (e *Encoder) LoopFilterLevel() (int, error) {
+	if err := e.requireCodec(CodecVP9, "loop filter level"); err != nil {
+		return 0, err
+	}
+	return e.controlIntPtr("get loop filter level", VP9EGetLoopfilterLevel)
+}
+
+// LastQuantizerSVCLayers returns the base quantizer of the last superframe for
+// each configured VP9 spatial layer.
+func (e *Encoder) LastQuantizerSVCLayers() ([]int, error) {
+	if err := e.requireCodec(CodecVP9, "last quantizer svc layers"); err != nil {
+		return nil, err
+	}
+	if e.ctx == nil {
+		return nil, ErrCodecClosed
+	}
+	var layers [SsMaxLayers]int32 // int[VPX_SS_MAX_LAYERS]
+	if err := codecError(e.ctx, "get last quantizer svc layers", CodecControlPtr(e.ctx, VP9EGetLastQuantizerSVCLayers, unsafe.Pointer(&layers))); err != nil {
+		return nil, err
+	}
+	n := int(e.cfg.SsNumberLayers)
+	if n < 1 {
+		n = 1
+	}
+	qs := make([]int, n)
+	for i := range qs {
+		qs[i] = int(layers[i])
+	}
+	return qs, nil
+}
+
+// ActiveMap returns the VP9 active map applied to the last encoded frame,
+// indexed [row][col] with one entry per 16x16 macroblock. Every block is
+// active unless an active map has been set. A map passed to SetActiveMap is
+// only reported once a frame has been encoded with it.
+func (e *Encoder) ActiveMap() ([][]bool, error) {
+	if err := e.requireCodec(CodecVP9, "active map"); err != nil {
+		return nil, err
+	}
+	if e.ctx == nil {
+		return nil, ErrCodecClosed
+	}
+	rows, cols := e.macroblocks()
+	buf := make([]byte, rows*cols)
+	if err := codecError(e.ctx, "get active map", CodecControlActiveMap(e.ctx, VP9EGetActiveMap, buf, uint32(rows), uint32(cols))); err != nil {
+		return nil, err
+	}
+	mask := make([][]bool, rows)
+	for r := range mask {
+		mask[r] = make([]bool, cols)
+		for c := range mask[r] {
+			mask[r][c] = buf[r*cols+c] != 0
+		}
+	}
+	return mask, nil
+}
+
+// SetActiveMap marks which 16x16 macroblocks the encoder codes in the
+// following frames; inactive blocks are skipped. mask is indexed [row][col]
+// and must cover the whole frame. A nil mask makes every block active again.
+// VP9 only honors active maps with the DlRealtime deadline, and drops the
+// map when it codes a keyframe.
+func (e *Encoder) SetActiveMap(mask [][]bool) error {
+	if e.ctx == nil {
+		return ErrCodecClosed
+	}
+	rows, cols := e.macroblocks()
+	var buf []byte
+	if mask != nil {
+		if len(mask) != rows {
+			return fmt.Errorf("%w: active map has %d rows, want %d", ErrCodecInvalidParam, len(mask), rows)
+		}
+		buf = make([]byte, rows*cols)
+		for r, row := range mask {
+			if len(row) != cols {
+				return fmt.Errorf("%w: active map row %d has %d columns, want %d", ErrCodecInvalidParam, r, len(row), cols)
+			}
+			for c, active := range row {
+				if active {
+					buf[r*cols+c] = 1
+				}
+			}
+		}
+	}
+	return codecError(e.ctx, "set active map", CodecControlActiveMap(e.ctx, VP8ESetActiveMap, buf, uint32(rows), uint32(cols)))
+}
+
+// macroblocks returns the frame size in 16x16 macroblocks.
+func (e *Encoder) macroblocks() (rows, cols int) {
+	return int(e.cfg.GH+15) / 16, int(e.cfg.GW+15) / 16
+}
+
+// SetROIMap applies region-of-interest coding to the frames encoded after
+// it. The map must have been created for this encoder's codec and frame size.
+// Call SetROIMap before each Encode to vary the regions per frame.
+// VP9 only honors ROI maps with the DlRealtime deadline.
+func (e *Encoder) SetROIMap(m *ROIMap) error {
+	if m == nil {
+		return fmt.Errorf("%w: nil roi map", ErrCodecInvalidParam)
+	}
+	if m.Codec != e.codec {
+		return fmt.Errorf("%w: roi map is for %s, encoder is %s", ErrCodecInvalidParam, m.Codec, e.codec)
+	}
+	if e.ctx == nil {
+		return ErrCodecClosed
+	}
+	want := NewROIMap(e.codec, int(e.cfg.GW), int(e.cfg.GH))
+	if m.Rows != want.Rows || m.Cols != want.Cols {
+		return fmt.Errorf("%w: roi map is %dx%d blocks, frame is %dx%d", ErrCodecInvalidParam, m.Rows, m.Cols, want.Rows, want.Cols)
+	}
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	return codecError(e.ctx, "set roi map", CodecControlROIMap(e.ctx, e.roiControl(), m))
+}
+
+// ClearROIMap disables region-of-interest coding.
+func (e *Encoder) ClearROIMap() error {
+	if e.ctx == nil {
+		return ErrCodecClosed
+	}
+	m := NewROIMap(e.codec, int(e.cfg.GW), int(e.cfg.GH))
+	m.Map = nil
+	return codecError(e.ctx, "clear roi map", CodecControlROIMap(e.ctx, e.roiControl(), m))
+}
+
+func (e *Encoder) roiControl() int {
+	if e.codec == CodecVP9 {
+		return VP9ESetROIMap
+	}
+	return VP8ESetROIMap
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,522 @@
+package vpx
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func newTestEncoder(t *testing.T, codec Codec) *Encoder {
+	t.Helper()
+
+	enc, err := NewEncoder(codec, EncoderOptions{
+		Width:   320,
+		Height:  240,
+		Bitrate: 200,
+	})
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	t.Cleanup(func() { enc.Close() })
+	return enc
+}
+
+func encodeFrames(t *testing.T, enc *Encoder, count int) {
+	t.Helper()
+
+	img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+	defer ImageFree(img)
+	img.Deref()
+
+	var packets int
+	for i := 0; i < count; i++ {
+		fillTestPattern(img, i)
+		pkts, err := enc.Encode(img, CodecPts(i), 0)
+		if err != nil {
+			t.Fatalf("Encode frame %d failed: %v", i, err)
+		}
+		packets += len(pkts)
+	}
+	pkts, err := enc.Flush()
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if packets+len(pkts) == 0 {
+		t.Fatal("no packets produced")
+	}
+}
+
+func TestEncoderVP8Controls(t *testing.T) {
+	tests := []struct {
+		name string
+		set  func(e *Encoder) error
+	}{
+		{"CPUUsed", func(e *Encoder) error { return e.SetCPUUsed(-16) }},
+		{"AutoAltRef", func(e *Encoder) error { return e.SetAutoAltRef(1) }},
+		{"NoiseSensitivity", func(e *Encoder) error { return e.SetNoiseSensitivity(3) }},
+		{"Sharpness", func(e *Encoder) error { return e.SetSharpness(7) }},
+		{"StaticThreshold", func(e *Encoder) error { return e.SetStaticThreshold(100) }},
+		{"TokenPartitions", func(e *Encoder) error { return e.SetTokenPartitions(EightTokenPartitions) }},
+		{"ARNRMaxFrames", func(e *Encoder) error { return e.SetARNRMaxFrames(15) }},
+		{"ARNRStrength", func(e *Encoder) error { return e.SetARNRStrength(6) }},
+		{"ARNRType", func(e *Encoder) error { return e.SetARNRType(3) }},
+		{"Tuning", func(e *Encoder) error { return e.SetTuning(TuneSSIM) }},
+		{"CQLevel", func(e *Encoder) error { return e.SetCQLevel(20) }},
+		{"MaxIntraBitratePct", func(e *Encoder) error { return e.SetMaxIntraBitratePct(300) }},
+		{"FrameFlags", func(e *Encoder) error { return e.SetFrameFlags(EflagForceKf) }},
+		{"TemporalLayerID", func(e *Encoder) error { return e.SetTemporalLayerID(0) }},
+		{"ScreenContentMode", func(e *Encoder) error { return e.SetScreenContentMode(ScreenContentOn) }},
+		{"GFCBRBoostPct", func(e *Encoder) error { return e.SetGFCBRBoostPct(50) }},
+		{"RTCExternalRateControl", func(e *Encoder) error { return e.SetRTCExternalRateControl(true) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := newTestEncoder(t, CodecVP8)
+			if err := tt.set(enc); err != nil {
+				t.Fatalf("setter failed: %v", err)
+			}
+			encodeFrames(t, enc, 3)
+		})
+	}
+}
+
+func TestEncoderVP9SharedControls(t *testing.T) {
+	enc := newTestEncoder(t, CodecVP9)
+
+	for name, err := range map[string]error{
+		"CPUUsed":                enc.SetCPUUsed(9),
+		"AutoAltRef":             enc.SetAutoAltRef(6),
+		"NoiseSensitivity":       enc.SetNoiseSensitivity(1),
+		"Sharpness":              enc.SetSharpness(3),
+		"GFCBRBoostPct":          enc.SetGFCBRBoostPct(50),
+		"RTCExternalRateControl": enc.SetRTCExternalRateControl(false),
+	} {
+		if err != nil {
+			t.Errorf("%s failed: %v", name, err)
+		}
+	}
+	encodeFrames(t, enc, 3)
+}
+
+func TestEncoderControlRange(t *testing.T) {
+	enc := newTestEncoder(t, CodecVP8)
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"cpu used", enc.SetCPUUsed(17)},
+		{"auto alt ref", enc.SetAutoAltRef(2)},
+		{"noise sensitivity", enc.SetNoiseSensitivity(-1)},
+		{"sharpness", enc.SetSharpness(8)},
+		{"token partitions", enc.SetTokenPartitions(4)},
+		{"arnr max frames", enc.SetARNRMaxFrames(16)},
+		{"arnr strength", enc.SetARNRStrength(7)},
+		{"arnr type", enc.SetARNRType(0)},
+		{"tuning", enc.SetTuning(2)},
+		{"cq level", enc.SetCQLevel(64)},
+		{"frame flags", enc.SetFrameFlags(-1)},
+		{"temporal layer id", enc.SetTemporalLayerID(TsMaxLayers)},
+		{"screen content mode", enc.SetScreenContentMode(3)},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, ErrCodecInvalidParam) {
+			t.Errorf("%s: error = %v, want ErrCodecInvalidParam", tt.name, tt.err)
+			continue
+		}
+		if !strings.Contains(tt.err.Error(), tt.name) {
+			t.Errorf("%s: error %q does not name the control", tt.name, tt.err)
+		}
+	}
+
+	vp9 := newTestEncoder(t, CodecVP9)
+	if err := vp9.SetCPUUsed(10); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("VP9 SetCPUUsed(10) = %v, want ErrCodecInvalidParam", err)
+	}
+}
+
+func TestEncoderVP8OnlyControls(t *testing.T) {
+	enc := newTestEncoder(t, CodecVP9)
+
+	for name, err := range map[string]error{
+		"TokenPartitions":   enc.SetTokenPartitions(TwoTokenPartitions),
+		"FrameFlags":        enc.SetFrameFlags(0),
+		"TemporalLayerID":   enc.SetTemporalLayerID(0),
+		"ScreenContentMode": enc.SetScreenContentMode(ScreenContentOn),
+	} {
+		if !errors.Is(err, ErrCodecIncapable) {
+			t.Errorf("%s on VP9 = %v, want ErrCodecIncapable", name, err)
+		}
+	}
+}
+
+func TestEncoderControlAfterClose(t *testing.T) {
+	enc := newTestEncoder(t, CodecVP8)
+	enc.Close()
+
+	if err := enc.SetSharpness(1); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("SetSharpness after Close = %v, want ErrCodecClosed", err)
+	}
+	if err := enc.SetStaticThreshold(1); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("SetStaticThreshold after Close = %v, want ErrCodecClosed", err)
+	}
+}
+
+func TestEncoderVP9Controls(t *testing.T) {
+	tests := []struct {
+		name string
+		set  func(e *Encoder) error
+	}{
+		{"Lossless", func(e *Encoder) error { return e.SetLossless(true) }},
+		{"AQMode", func(e *Encoder) error { return e.SetAQMode(AQCyclicRefresh) }},
+		{"TuneContent", func(e *Encoder) error { return e.SetTuneContent(ContentScreen) }},
+		{"FramePeriodicBoost", func(e *Encoder) error { return e.SetFramePeriodicBoost(true) }},
+		{"MinGFInterval", func(e *Encoder) error { return e.SetMinGFInterval(2) }},
+		{"MaxGFInterval", func(e *Encoder) error { return e.SetMaxGFInterval(16) }},
+		{"TargetLevel", func(e *Encoder) error { return e.SetTargetLevel(Level41) }},
+		{"DeltaQUV", func(e *Encoder) error { return e.SetDeltaQUV(-15) }},
+		{"AltRefAQ", func(e *Encoder) error { return e.SetAltRefAQ(true) }},
+		{"KeyFrameFiltering", func(e *Encoder) error { return e.SetKeyFrameFiltering(true) }},
+		{"PostencodeDrop", func(e *Encoder) error { return e.SetPostencodeDrop(true) }},
+		{"QuantizerOnePass", func(e *Encoder) error { return e.SetQuantizerOnePass(40) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := newTestEncoder(t, CodecVP9)
+			if err := tt.set(enc); err != nil {
+				t.Fatalf("setter failed: %v", err)
+			}
+			encodeFrames(t, enc, 3)
+		})
+	}
+}
+
+func TestEncoderVP9ControlRange(t *testing.T) {
+	enc := newTestEncoder(t, CodecVP9)
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"aq mode", enc.SetAQMode(AQEquator360 + 1)},
+		{"tune content", enc.SetTuneContent(ContentFilm + 1)},
+		{"min gf interval", enc.SetMinGFInterval(25)},
+		{"max gf interval", enc.SetMaxGFInterval(-1)},
+		{"target level", enc.SetTargetLevel(12)},
+		{"delta q uv", enc.SetDeltaQUV(16)},
+		{"quantizer one pass", enc.SetQuantizerOnePass(64)},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, ErrCodecInvalidParam) {
+			t.Errorf("%s: error = %v, want ErrCodecInvalidParam", tt.name, tt.err)
+			continue
+		}
+		if !strings.Contains(tt.err.Error(), tt.name) {
+			t.Errorf("%s: error %q does not name the control", tt.name, tt.err)
+		}
+	}
+
+	for _, level := range []Level{LevelStatsOnly, LevelOff, Level1, Level62} {
+		if err := enc.SetTargetLevel(level); err != nil {
+			t.Errorf("SetTargetLevel(%d) failed: %v", level, err)
+		}
+	}
+}
+
+func TestEncoderVP9OnlyControls(t *testing.T) {
+	enc := newTestEncoder(t, CodecVP8)
+
+	for name, err := range map[string]error{
+		"Lossless":         enc.SetLossless(true),
+		"AQMode":           enc.SetAQMode(AQVariance),
+		"TuneContent":      enc.SetTuneContent(ContentFilm),
+		"TargetLevel":      enc.SetTargetLevel(Level3),
+		"QuantizerOnePass": enc.SetQuantizerOnePass(10),
+	} {
+		if !errors.Is(err, ErrCodecIncapable) {
+			t.Errorf("%s on VP8 = %v, want ErrCodecIncapable", name, err)
+		}
+	}
+}
+
+func TestEncoderVP9Lossless(t *testing.T) {
+	enc := newTestEncoder(t, CodecVP9)
+	if err := enc.SetLossless(true); err != nil {
+		t.Fatalf("SetLossless failed: %v", err)
+	}
+
+	img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+	defer ImageFree(img)
+	img.Deref()
+	fillTestPattern(img, 0)
+
+	packets, err := enc.Encode(img, 0, 0)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	flushed, err := enc.Flush()
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	packets = append(packets, flushed...)
+	if len(packets) != 1 {
+		t.Fatalf("got %d packets, want 1", len(packets))
+	}
+
+	dec, err := NewDecoder(CodecVP9, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer dec.Close()
+
+	frames, err := dec.Decode(packets[0].Data)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if len(frames) != 1 {
+		t.Fatalf("decoded %d frames, want 1", len(frames))
+	}
+	for _, plane := range []int{PlaneY, PlaneU, PlaneV} {
+		if !bytes.Equal(visiblePlane(frames[0].Image(), plane), visiblePlane(img, plane)) {
+			t.Errorf("plane %d differs from the source", plane)
+		}
+	}
+}
+
+func TestLevelString(t *testing.T) {
+	tests := []struct {
+		level Level
+		want  string
+	}{
+		{Level1, "1.0"},
+		{Level41, "4.1"},
+		{Level62, "6.2"},
+		{LevelOff, ""},
+		{Level(12), ""},
+	}
+	for _, tt := range tests {
+		if got := tt.level.String(); got != tt.want {
+			t.Errorf("Level(%d).String() = %q, want %q", int(tt.level), got, tt.want)
+		}
+	}
+}
+
+func TestEncoderLastQuantizer(t *testing.T) {
+	for _, codec := range []Codec{CodecVP8, CodecVP9} {
+		t.Run(codec.String(), func(t *testing.T) {
+			enc, err := NewEncoder(codec, EncoderOptions{
+				Width:  320,
+				Height: 240,
+				Configure: func(cfg *CodecEncCfg) {
+					cfg.RcMinQuantizer = 30
+					cfg.RcMaxQuantizer = 40
+				},
+			})
+			if err != nil {
+				t.Fatalf("NewEncoder failed: %v", err)
+			}
+			defer enc.Close()
+			encodeFrames(t, enc, 3)
+
+			q64, err := enc.LastQuantizer64()
+			if err != nil {
+				t.Fatalf("LastQuantizer64 failed: %v", err)
+			}
+			if q64 < 30 || q64 > 40 {
+				t.Errorf("LastQuantizer64 = %d, want within [30, 40]", q64)
+			}
+			q, err := enc.LastQuantizer()
+			if err != nil {
+				t.Fatalf("LastQuantizer failed: %v", err)
+			}
+			if q <= q64 {
+				t.Errorf("LastQuantizer = %d, want above the 0..63 value %d", q, q64)
+			}
+		})
+	}
+}
+
+func TestEncoderLevel(t *testing.T) {
+	enc := newTestEncoder(t, CodecVP9)
+	if err := enc.SetTargetLevel(LevelStatsOnly); err != nil {
+		t.Fatalf("SetTargetLevel failed: %v", err)
+	}
+	encodeFrames(t, enc, 5)
+
+	level, err := enc.Level()
+	if err != nil {
+		t.Fatalf("Level failed: %v", err)
+	}
+	if level.String() == "" {
+		t.Errorf("Level = %d, want a named VP9 level", int(level))
+	}
+	if level > Level21 {
+		t.Errorf("Level = %s, want at most 2.1 for 320x240", level)
+	}
+
+	lf, err := enc.LoopFilterLevel()
+	if err != nil {
+		t.Fatalf("LoopFilterLevel failed: %v", err)
+	}
+	if lf < 0 || lf > 63 {
+		t.Errorf("LoopFilterLevel = %d, want within [0, 63]", lf)
+	}
+
+	qs, err := enc.LastQuantizerSVCLayers()
+	if err != nil {
+		t.Fatalf("LastQuantizerSVCLayers failed: %v", err)
+	}
+	if len(qs) != 1 {
+		t.Errorf("LastQuantizerSVCLayers returned %d layers, want 1", len(qs))
+	}
+}
+
+func TestEncoderActiveMapDefault(t *testing.T) {
+	enc := newTestEncoder(t, CodecVP9)
+
+	mask, err := enc.ActiveMap()
+	if err != nil {
+		t.Fatalf("ActiveMap failed: %v", err)
+	}
+	if len(mask) != 15 || len(mask[0]) != 20 {
+		t.Fatalf("ActiveMap is %dx%d, want 15x20", len(mask), len(mask[0]))
+	}
+	for r, row := range mask {
+		for c, active := range row {
+			if !active {
+				t.Fatalf("block (%d, %d) is inactive", r, c)
+			}
+		}
+	}
+}
+
+func TestEncoderVP9OnlyGetters(t *testing.T) {
+	enc := newTestEncoder(t, CodecVP8)
+
+	if _, err := enc.Level(); !errors.Is(err, ErrCodecIncapable) {
+		t.Errorf("Level on VP8 = %v, want ErrCodecIncapable", err)
+	}
+	if _, err := enc.LoopFilterLevel(); !errors.Is(err, ErrCodecIncapable) {
+		t.Errorf("LoopFilterLevel on VP8 = %v, want ErrCodecIncapable", err)
+	}
+	if _, err := enc.LastQuantizerSVCLayers(); !errors.Is(err, ErrCodecIncapable) {
+		t.Errorf("LastQuantizerSVCLayers on VP8 = %v, want ErrCodecIncapable", err)
+	}
+	if _, err := enc.ActiveMap(); !errors.Is(err, ErrCodecIncapable) {
+		t.Errorf("ActiveMap on VP8 = %v, want ErrCodecIncapable", err)
+	}
+
+	enc.Close()
+	if _, err := enc.LastQuantizer(); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("LastQuantizer after Close = %v, want ErrCodecClosed", err)
+	}
+}
+
+func TestEncoderScalingMode(t *testing.T) {
+	for _, codec := range []Codec{CodecVP8, CodecVP9} {
+		t.Run(codec.String(), func(t *testing.T) {
+			const (
+				width      = 320
+				height     = 240
+				frameCount = 6
+				switchAt   = 2
+			)
+
+			var sizes [2]int
+			for i, scale := range []bool{false, true} {
+				// A fixed quantizer makes the byte count follow the coded area.
+				enc, err := NewEncoder(codec, EncoderOptions{
+					Width:    width,
+					Height:   height,
+					Bitrate:  1000,
+					Deadline: DlRealtime,
+					Configure: func(cfg *CodecEncCfg) {
+						cfg.GLagInFrames = 0
+						cfg.RcMinQuantizer = 40
+						cfg.RcMaxQuantizer = 40
+					},
+				})
+				if err != nil {
+					t.Fatalf("NewEncoder failed: %v", err)
+				}
+				defer enc.Close()
+				if err := enc.SetCPUUsed(8); err != nil {
+					t.Fatalf("SetCPUUsed failed: %v", err)
+				}
+
+				dec, err := NewDecoder(codec, DecoderOptions{})
+				if err != nil {
+					t.Fatalf("NewDecoder failed: %v", err)
+				}
+				defer dec.Close()
+
+				img := ImageAlloc(nil, ImageFormatI420, width, height, 1)
+				defer ImageFree(img)
+				img.Deref()
+
+				for frame := 0; frame < frameCount; frame++ {
+					if scale && frame == switchAt {
+						if err := enc.SetScalingMode(ScalingOneTwo, ScalingOneTwo); err != nil {
+							t.Fatalf("SetScalingMode failed: %v", err)
+						}
+					}
+					fillNoise(img, int64(frame))
+					pkts, err := enc.Encode(img, CodecPts(frame), 0)
+					if err != nil {
+						t.Fatalf("Encode failed: %v", err)
+					}
+					for _, pkt := range pkts {
+						if frame > switchAt {
+							sizes[i] += len(pkt.Data)
+						}
+						frames, err := dec.Decode(pkt.Data)
+						if err != nil {
+							t.Fatalf("Decode failed: %v", err)
+						}
+						for _, f := range frames {
+							w, h := f.Width(), f.Height()
+							if codec == CodecVP9 {
+								w, h = int(f.Image().RW), int(f.Image().RH)
+							}
+							if w != width || h != height {
+								t.Errorf("frame %d presented at %dx%d, want %dx%d", frame, w, h, width, height)
+							}
+						}
+					}
+				}
+			}
+			if sizes[1]*2 > sizes[0] {
+				t.Errorf("scaled frames used %d bytes, want well below %d unscaled", sizes[1], sizes[0])
+			}
+		})
+	}
+}
+
+func TestEncoderScalingModeRange(t *testing.T) {
+	enc := newTestEncoder(t, CodecVP8)
+
+	if err := enc.SetScalingMode(ScalingOneTwo+1, ScalingNormal); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("horizontal mode error = %v, want ErrCodecInvalidParam", err)
+	}
+	if err := enc.SetScalingMode(ScalingNormal, -1); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("vertical mode error = %v, want ErrCodecInvalidParam", err)
+	}
+	if err := enc.SetScalingMode(ScalingFourFive, ScalingThreeFive); err != nil {
+		t.Errorf("SetScalingMode failed: %v", err)
+	}
+}
+
+// fillNoise fills the luma plane of img with reproducible noise, which
+// costs roughly the same number of bits per pixel in every frame.
+func fillNoise(img *Image, seed int64) {
+	rng := rand.New(rand.NewSource(seed))
+	y := unsafe.Slice(img.Planes[PlaneY], int(img.Stride[PlaneY])*int(img.DH))
+	for i := range y {
+		y[i] = byte(rng.Intn(256))
+	}
+}
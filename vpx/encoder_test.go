@@ -0,0 +1,248 @@
+package vpx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncoderEncodeAndFlush(t *testing.T) {
+	for _, codec := range []Codec{CodecVP8, CodecVP9} {
+		t.Run(codec.String(), func(t *testing.T) {
+			const (
+				width      = 320
+				height     = 240
+				frameCount = 10
+			)
+
+			enc, err := NewEncoder(codec, EncoderOptions{
+				Width:   width,
+				Height:  height,
+				Bitrate: 200,
+			})
+			if err != nil {
+				t.Fatalf("NewEncoder failed: %v", err)
+			}
+			defer enc.Close()
+
+			img := ImageAlloc(nil, ImageFormatI420, width, height, 1)
+			defer ImageFree(img)
+			img.Deref()
+
+			var packets []Packet
+			for i := 0; i < frameCount; i++ {
+				fillTestPattern(img, i)
+				pkts, err := enc.Encode(img, CodecPts(i), 0)
+				if err != nil {
+					t.Fatalf("Encode frame %d failed: %v", i, err)
+				}
+				packets = append(packets, pkts...)
+			}
+			pkts, err := enc.Flush()
+			if err != nil {
+				t.Fatalf("Flush failed: %v", err)
+			}
+			packets = append(packets, pkts...)
+
+			if len(packets) == 0 {
+				t.Fatal("no packets produced")
+			}
+			if !packets[0].IsKeyframe() {
+				t.Error("first packet is not a keyframe")
+			}
+
+			var visible int
+			for i, pkt := range packets {
+				if len(pkt.Data) == 0 {
+					t.Errorf("packet %d has no data", i)
+				}
+				if !pkt.IsInvisible() {
+					visible++
+				}
+			}
+			if visible != frameCount {
+				t.Errorf("got %d visible packets, want %d", visible, frameCount)
+			}
+
+			frames := decodePacketData(t, codec, packets)
+			if frames != frameCount {
+				t.Errorf("decoded %d frames, want %d", frames, frameCount)
+			}
+		})
+	}
+}
+
+func TestEncoderPacketPts(t *testing.T) {
+	enc, err := NewEncoder(CodecVP8, EncoderOptions{Width: 320, Height: 240})
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	defer enc.Close()
+
+	img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+	defer ImageFree(img)
+	img.Deref()
+
+	for i := 0; i < 3; i++ {
+		fillTestPattern(img, i)
+		pkts, err := enc.Encode(img, CodecPts(i*10), 0)
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		if len(pkts) != 1 {
+			t.Fatalf("got %d packets, want 1", len(pkts))
+		}
+		if pkts[0].Pts != CodecPts(i*10) {
+			t.Errorf("packet pts = %d, want %d", pkts[0].Pts, i*10)
+		}
+		if pkts[0].Duration != 1 {
+			t.Errorf("packet duration = %d, want 1", pkts[0].Duration)
+		}
+	}
+}
+
+func TestEncoderForceKeyframe(t *testing.T) {
+	enc, err := NewEncoder(CodecVP8, EncoderOptions{
+		Width:  320,
+		Height: 240,
+		Configure: func(cfg *CodecEncCfg) {
+			cfg.KfMode = KfDisabled
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	defer enc.Close()
+
+	img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+	defer ImageFree(img)
+	img.Deref()
+
+	for i, flags := range []EncFrameFlags{0, 0, EflagForceKf} {
+		fillTestPattern(img, i)
+		pkts, err := enc.Encode(img, CodecPts(i), flags)
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		if len(pkts) != 1 {
+			t.Fatalf("got %d packets, want 1", len(pkts))
+		}
+		wantKey := i != 1
+		if pkts[0].IsKeyframe() != wantKey {
+			t.Errorf("frame %d keyframe = %v, want %v", i, pkts[0].IsKeyframe(), wantKey)
+		}
+	}
+}
+
+func TestNewEncoderInvalidConfig(t *testing.T) {
+	_, err := NewEncoder(CodecVP8, EncoderOptions{
+		Width:  320,
+		Height: 240,
+		Configure: func(cfg *CodecEncCfg) {
+			cfg.RcMaxQuantizer = 100
+		},
+	})
+	if err == nil {
+		t.Fatal("expected NewEncoder to fail")
+	}
+	if !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("error %v does not match ErrCodecInvalidParam", err)
+	}
+	if !strings.Contains(err.Error(), "rc_max_quantizer") {
+		t.Errorf("error %q does not carry the libvpx detail", err)
+	}
+}
+
+func TestNewEncoderUnsupportedCodec(t *testing.T) {
+	if _, err := NewEncoder(Codec(0), EncoderOptions{}); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Fatalf("NewEncoder error = %v, want ErrCodecInvalidParam", err)
+	}
+}
+
+func TestEncoderClose(t *testing.T) {
+	enc, err := NewEncoder(CodecVP9, EncoderOptions{Width: 320, Height: 240})
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("second Close failed: %v", err)
+	}
+	if enc.Ctx() != nil {
+		t.Error("Ctx is not nil after Close")
+	}
+
+	img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+	defer ImageFree(img)
+	if _, err := enc.Encode(img, 0, 0); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("Encode after Close = %v, want ErrCodecClosed", err)
+	}
+	if _, err := enc.Flush(); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("Flush after Close = %v, want ErrCodecClosed", err)
+	}
+}
+
+// decodePacketData decodes packets with the low-level API and returns the
+// number of frames produced.
+func decodePacketData(t *testing.T, codec Codec, packets []Packet) int {
+	t.Helper()
+
+	ctx := NewCodecCtx()
+	defer CodecDestroy(ctx)
+
+	if err := Error(CodecDecInitVer(ctx, DecoderFor(int(codec)), nil, 0, DecoderABIVersion)); err != nil {
+		t.Fatalf("failed to initialize decoder: %v", err)
+	}
+
+	var frames int
+	for i, pkt := range packets {
+		if err := Error(CodecDecode(ctx, string(pkt.Data), uint32(len(pkt.Data)), nil, 0)); err != nil {
+			t.Fatalf("failed to decode packet %d: %v", i, err)
+		}
+		var iter CodecIter
+		for img := CodecGetFrame(ctx, &iter); img != nil; img = CodecGetFrame(ctx, &iter) {
+			frames++
+		}
+	}
+	return frames
+}
+
+// encodeTestPackets encodes count test pattern frames with an Encoder and
+// returns every packet, including those produced by Flush.
+func encodeTestPackets(t *testing.T, codec Codec, width, height uint32, count int) []Packet {
+	t.Helper()
+
+	enc, err := NewEncoder(codec, EncoderOptions{
+		Width:   width,
+		Height:  height,
+		Bitrate: 200,
+		Configure: func(cfg *CodecEncCfg) {
+			cfg.GLagInFrames = 0
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	defer enc.Close()
+
+	img := ImageAlloc(nil, ImageFormatI420, width, height, 1)
+	defer ImageFree(img)
+	img.Deref()
+
+	var packets []Packet
+	for i := 0; i < count; i++ {
+		fillTestPattern(img, i)
+		pkts, err := enc.Encode(img, CodecPts(i), 0)
+		if err != nil {
+			t.Fatalf("Encode frame %d failed: %v", i, err)
+		}
+		packets = append(packets, pkts...)
+	}
+	pkts, err := enc.Flush()
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	return append(packets, pkts...)
+}
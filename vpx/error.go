@@ -1,6 +1,10 @@
 package vpx
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 func Error(err CodecErr) error {
 	switch err {
@@ -36,4 +40,47 @@ var (
 	ErrCodecUnsupFeature   = errors.New("vpx: unsupported feature")
 	ErrCodecCorruptFrame   = errors.New("vpx: corrupt frame")
 	ErrCodecInvalidParam   = errors.New("vpx: invalid param")
+	ErrCodecClosed         = errors.New("vpx: codec closed")
 )
+
+// CodecOpError is a libvpx failure returned by the high-level API. It keeps
+// the messages libvpx reported for the codec context, and matches the
+// sentinel returned by Error for Code when tested with errors.Is.
+type CodecOpError struct {
+	// Code is the status libvpx returned.
+	Code CodecErr
+	// Op is the operation that failed, such as "encode" or "decoder init".
+	Op string
+	// Message is the error string of the context (CodecGetError).
+	Message string
+	// Detail is the detailed message of the context (CodecErrorDetail),
+	// such as "Invalid frame width". It is often empty.
+	Detail string
+}
+
+func (e *CodecOpError) Error() string {
+	msg := e.Message
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return fmt.Sprintf("%v: %s: %s", Error(e.Code), e.Op, msg)
+}
+
+// Is reports whether target is the sentinel error for e.Code.
+func (e *CodecOpError) Is(target error) bool {
+	return target == Error(e.Code)
+}
+
+// codecError converts a failed CodecErr into a *CodecOpError that carries the
+// libvpx error string and detail of ctx.
+func codecError(ctx *CodecCtx, op string, err CodecErr) error {
+	if err == CodecOk {
+		return nil
+	}
+	return &CodecOpError{
+		Code:    err,
+		Op:      op,
+		Message: strings.Clone(CodecGetError(ctx)),
+		Detail:  strings.Clone(CodecErrorDetail(ctx)),
+	}
+}
@@ -1,6 +1,7 @@
 package vpx
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -112,3 +113,34 @@ func TestErrorMessages(t *testing.T) {
 		})
 	}
 }
+
+func TestCodecOpError(t *testing.T) {
+	err := error(&CodecOpError{Code: CodecInvalidParam, Op: "encoder init", Message: "Invalid parameter", Detail: "g_w out of range [1..16383]"})
+	if want := "vpx: invalid param: encoder init: Invalid parameter: g_w out of range [1..16383]"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	if !errors.Is(err, ErrCodecInvalidParam) || errors.Is(err, ErrCodecIncapable) {
+		t.Errorf("errors.Is does not match %v against its sentinel only", err)
+	}
+	err = &CodecOpError{Code: CodecCorruptFrame, Op: "decode", Message: "Corrupt frame detected"}
+	if want := "vpx: corrupt frame: decode: Corrupt frame detected"; err.Error() != want {
+		t.Errorf("Error() without detail = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestCodecOpErrorFromEncoder(t *testing.T) {
+	_, err := NewEncoder(CodecVP8, EncoderOptions{Width: 20000, Height: 240})
+	var opErr *CodecOpError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("NewEncoder with an invalid width = %v, want a *CodecOpError", err)
+	}
+	if opErr.Code != CodecInvalidParam || opErr.Op != "encoder init" {
+		t.Errorf("got code %v op %q, want CodecInvalidParam from encoder init", opErr.Code, opErr.Op)
+	}
+	if opErr.Message == "" || opErr.Detail != "g_w out of range [1..16383]" {
+		t.Errorf("message %q detail %q, want the libvpx config check", opErr.Message, opErr.Detail)
+	}
+	if !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("errors.Is(%v, ErrCodecInvalidParam) = false", err)
+	}
+}
@@ -0,0 +1,104 @@
+package vpx
+
+/*
+#include <stdlib.h>
+
+// fragment_placeholder returns the data passed by dropFragments. libvpx
+// does not read it.
+static unsigned char *fragment_placeholder(void) {
+	static unsigned char placeholder;
+	return &placeholder;
+}
+*/
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+// maxFragments is the number of fragments a VP8 frame holds at most: the
+// first partition and up to eight token partitions, MAX_PARTITIONS in
+// libvpx.
+const maxFragments = 9
+
+// DecodeFragment passes the next fragment of a frame to a decoder created
+// with InputFragments, such as a VP8 partition as soon as it arrives from
+// the network. Each fragment must hold whole partitions, the first one the
+// frame header and the first partition. Call EndFrame after the last
+// fragment of the frame. The fragment is copied, so data may be reused.
+func (d *Decoder) DecodeFragment(data []byte) error {
+	if !d.inputFragments {
+		return fmt.Errorf("%w: decode fragment: decoder was not created with InputFragments", ErrCodecInvalidParam)
+	}
+	if d.ctx == nil {
+		return ErrCodecClosed
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("%w: decode fragment: empty fragment", ErrCodecInvalidParam)
+	}
+	d.gen++
+	// libvpx keeps pointers to the fragments until the frame is complete.
+	cdata := C.malloc(C.size_t(len(data)))
+	if cdata == nil {
+		return ErrCodecMemError
+	}
+	copy(unsafe.Slice((*byte)(cdata), len(data)), data)
+	d.fragments = append(d.fragments, cdata)
+	d.addDecryptRegion(cdata, len(data))
+	cstr := unsafe.String((*byte)(cdata), len(data))
+	if err := codecError(d.ctx, "decode fragment", CodecDecode(d.ctx, cstr, uint32(len(data)), nil, 0)); err != nil {
+		d.freeFragments()
+		return err
+	}
+	return nil
+}
+
+// EndFrame decodes the fragments passed since the last frame and returns
+// the frames produced, like Decode. When the frame cannot be decoded, such
+// as when a fragment was lost, its fragments are dropped and decoding goes
+// on with the next frame; the frames that follow are reported as
+// FrameInfo.Corrupted until the next keyframe.
+func (d *Decoder) EndFrame() ([]*Frame, error) {
+	if !d.inputFragments {
+		return nil, fmt.Errorf("%w: end frame: decoder was not created with InputFragments", ErrCodecInvalidParam)
+	}
+	if d.ctx == nil {
+		return nil, ErrCodecClosed
+	}
+	d.gen++
+	defer d.freeFragments()
+	if err := codecError(d.ctx, "end frame", CodecDecode(d.ctx, "", 0, nil, 0)); err != nil {
+		d.dropFragments()
+		return nil, err
+	}
+	return d.frames(), nil
+}
+
+// dropFragments makes libvpx forget the fragments of a frame it failed to
+// decode: VP8 keeps them on most errors and would add the next frame's
+// fragments to them. Its list is only cleared when it overflows, so fill
+// it with a placeholder until libvpx rejects one.
+//
+// This relies on update_fragments in libvpx's vp8/vp8_dx_iface.c (checked
+// against 1.15.2): with fragments enabled, it stores non-empty data without
+// reading it, and once MAX_PARTITIONS (maxFragments) are stored it resets
+// the count and fails with VPX_CODEC_INVALID_PARAM. Revisit this when
+// upgrading libvpx; TestDecoderPacketLoss fails if decoding stops
+// recovering after a lost partition.
+func (d *Decoder) dropFragments() {
+	placeholder := unsafe.String((*byte)(C.fragment_placeholder()), 1)
+	for i := 0; i <= maxFragments; i++ {
+		if CodecDecode(d.ctx, placeholder, 1, nil, 0) != CodecOk {
+			return
+		}
+	}
+}
+
+// freeFragments releases the copies of the fragments of the last frame.
+func (d *Decoder) freeFragments() {
+	for _, p := range d.fragments {
+		C.free(p)
+	}
+	d.fragments = d.fragments[:0]
+	d.clearDecryptRegions()
+}
@@ -0,0 +1,247 @@
+package vpx
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// splitVP8Partitions splits a VP8 frame with count token partitions into
+// its first partition, including the frame header and the partition size
+// table, and its token partitions.
+func splitVP8Partitions(t *testing.T, data []byte, count int) [][]byte {
+	t.Helper()
+	tag := int(data[0]) | int(data[1])<<8 | int(data[2])<<16
+	header := 3
+	if tag&1 == 0 {
+		// Keyframes add a start code and the frame size.
+		header += 7
+	}
+	offset := header + tag>>5 + 3*(count-1)
+	sizes := data[offset-3*(count-1) : offset]
+	parts := [][]byte{data[:offset]}
+	for i := 0; i < count-1; i++ {
+		size := int(sizes[3*i]) | int(sizes[3*i+1])<<8 | int(sizes[3*i+2])<<16
+		parts = append(parts, data[offset:offset+size])
+		offset += size
+	}
+	return append(parts, data[offset:])
+}
+
+func TestDecoderInputFragments(t *testing.T) {
+	enc := newRealtimeEncoder(t, CodecVP8)
+	if err := enc.SetTokenPartitions(FourTokenPartitions); err != nil {
+		t.Fatalf("SetTokenPartitions failed: %v", err)
+	}
+	plain, err := NewDecoder(CodecVP8, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer plain.Close()
+	fragmented, err := NewDecoder(CodecVP8, DecoderOptions{InputFragments: true})
+	if err != nil {
+		t.Fatalf("NewDecoder(InputFragments) failed: %v", err)
+	}
+	defer fragmented.Close()
+	whole, err := NewDecoder(CodecVP8, DecoderOptions{InputFragments: true})
+	if err != nil {
+		t.Fatalf("NewDecoder(InputFragments) failed: %v", err)
+	}
+	defer whole.Close()
+
+	img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+	defer ImageFree(img)
+	img.Deref()
+
+	var last []byte
+	for i := 0; i < 4; i++ {
+		fillTestPattern(img, i)
+		pkts, err := enc.Encode(img, CodecPts(i), 0)
+		if err != nil || len(pkts) != 1 {
+			t.Fatalf("Encode frame %d = %d packets, %v", i, len(pkts), err)
+		}
+		last = pkts[0].Data
+		want, err := plain.Decode(pkts[0].Data)
+		if err != nil || len(want) != 1 {
+			t.Fatalf("frame %d: decode = %d frames, %v", i, len(want), err)
+		}
+
+		parts := splitVP8Partitions(t, pkts[0].Data, 4)
+		if len(parts) != 5 {
+			t.Fatalf("frame %d split into %d partitions, want 5", i, len(parts))
+		}
+		for _, part := range parts {
+			// Reuse the caller's buffer: the decoder must keep its own copy.
+			buf := append([]byte(nil), part...)
+			if err := fragmented.DecodeFragment(buf); err != nil {
+				t.Fatalf("frame %d: DecodeFragment failed: %v", i, err)
+			}
+			clear(buf)
+		}
+		got, err := fragmented.EndFrame()
+		if err != nil || len(got) != 1 {
+			t.Fatalf("frame %d: EndFrame = %d frames, %v", i, len(got), err)
+		}
+		if !equalImages(got[0].Image(), want[0].Image()) {
+			t.Errorf("frame %d decoded from partitions differs", i)
+		}
+
+		got, err = whole.Decode(pkts[0].Data)
+		if err != nil || len(got) != 1 {
+			t.Fatalf("frame %d: single fragment decode = %d frames, %v", i, len(got), err)
+		}
+		if !equalImages(got[0].Image(), want[0].Image()) {
+			t.Errorf("frame %d decoded as a single fragment differs", i)
+		}
+	}
+	if _, err := fragmented.Flush(); err != nil {
+		t.Errorf("Flush failed: %v", err)
+	}
+
+	// Empty data flushes, decoding the fragments passed so far.
+	for _, part := range splitVP8Partitions(t, last, 4) {
+		if err := fragmented.DecodeFragment(part); err != nil {
+			t.Fatalf("DecodeFragment failed: %v", err)
+		}
+	}
+	if got, err := fragmented.Decode(nil); err != nil || len(got) != 1 {
+		t.Errorf("Decode(nil) with pending fragments = %d frames, %v, want 1 frame", len(got), err)
+	}
+	if got, err := fragmented.Decode(nil); err != nil || len(got) != 0 {
+		t.Errorf("Decode(nil) = %d frames, %v, want none", len(got), err)
+	}
+}
+
+func TestDecoderFragmentErrors(t *testing.T) {
+	if CodecGetCaps(DecoderFor(int(CodecVP9)))&CodecCapInputFragments == 0 {
+		if _, err := NewDecoder(CodecVP9, DecoderOptions{InputFragments: true}); !errors.Is(err, ErrCodecIncapable) {
+			t.Errorf("VP9 InputFragments = %v, want ErrCodecIncapable", err)
+		}
+	}
+
+	dec, err := NewDecoder(CodecVP8, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer dec.Close()
+	if err := dec.DecodeFragment([]byte{0}); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("DecodeFragment without InputFragments = %v, want ErrCodecInvalidParam", err)
+	}
+	if _, err := dec.EndFrame(); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("EndFrame without InputFragments = %v, want ErrCodecInvalidParam", err)
+	}
+
+	frag, err := NewDecoder(CodecVP8, DecoderOptions{InputFragments: true})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	if err := frag.DecodeFragment(nil); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("DecodeFragment(nil) = %v, want ErrCodecInvalidParam", err)
+	}
+	frag.Close()
+	if err := frag.DecodeFragment([]byte{0}); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("closed: DecodeFragment = %v, want ErrCodecClosed", err)
+	}
+	if _, err := frag.EndFrame(); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("closed: EndFrame = %v, want ErrCodecClosed", err)
+	}
+}
+
+func TestDecoderOnSlice(t *testing.T) {
+	// Neither decoder of the bundled libvpx implements slice callbacks.
+	for _, codec := range []Codec{CodecVP8, CodecVP9} {
+		if CodecGetCaps(DecoderFor(int(codec)))&CodecCapPutSlice != 0 {
+			t.Fatalf("%s decoder has CodecCapPutSlice: test the slice callbacks", codec)
+		}
+		opts := DecoderOptions{OnSlice: func(img *Image, valid, update *ImageRect) {}}
+		if _, err := NewDecoder(codec, opts); !errors.Is(err, ErrCodecIncapable) {
+			t.Errorf("%s OnSlice = %v, want ErrCodecIncapable", codec, err)
+		}
+	}
+}
+
+func TestDecoderPacketLoss(t *testing.T) {
+	opts := []DecoderOptions{{InputFragments: true}}
+	if CodecGetCaps(DecoderFor(int(CodecVP8)))&CodecCapErrorConcealment != 0 {
+		opts = append(opts, DecoderOptions{InputFragments: true, ErrorConcealment: true})
+	} else if _, err := NewDecoder(CodecVP8, DecoderOptions{ErrorConcealment: true}); !errors.Is(err, ErrCodecIncapable) {
+		t.Errorf("ErrorConcealment without the capability = %v, want ErrCodecIncapable", err)
+	}
+
+	enc := newRealtimeEncoder(t, CodecVP8)
+	if err := enc.SetTokenPartitions(FourTokenPartitions); err != nil {
+		t.Fatalf("SetTokenPartitions failed: %v", err)
+	}
+	img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+	defer ImageFree(img)
+	img.Deref()
+	const frames, keyframe = 12, 8
+	var packets [][]byte
+	for i := 0; i < frames; i++ {
+		fillTestPattern(img, i)
+		var flags EncFrameFlags
+		if i == keyframe {
+			flags = flags.ForceKeyframe()
+		}
+		pkts, err := enc.Encode(img, CodecPts(i), flags)
+		if err != nil || len(pkts) != 1 {
+			t.Fatalf("Encode frame %d = %d packets, %v", i, len(pkts), err)
+		}
+		packets = append(packets, pkts[0].Data)
+	}
+	want := make([]*Frame, frames)
+	plain, err := NewDecoder(CodecVP8, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer plain.Close()
+	for i, p := range packets {
+		got, err := plain.Decode(p)
+		if err != nil || len(got) != 1 {
+			t.Fatalf("frame %d: decode = %d frames, %v", i, len(got), err)
+		}
+		want[i] = got[0].Clone()
+	}
+
+	// lost lists the token partitions dropped from each frame.
+	lost := map[int][]int{2: {2}, 4: {3, 4}, 6: {1}}
+	for _, o := range opts {
+		t.Run(fmt.Sprintf("ErrorConcealment=%v", o.ErrorConcealment), func(t *testing.T) {
+			dec, err := NewDecoder(CodecVP8, o)
+			if err != nil {
+				t.Fatalf("NewDecoder(%+v) failed: %v", o, err)
+			}
+			defer dec.Close()
+			for i, p := range packets {
+				for j, part := range splitVP8Partitions(t, p, 4) {
+					if slices.Contains(lost[i], j) {
+						continue
+					}
+					if err := dec.DecodeFragment(part); err != nil {
+						t.Fatalf("frame %d: DecodeFragment failed: %v", i, err)
+					}
+				}
+				got, err := dec.EndFrame()
+				if err != nil && lost[i] != nil && !o.ErrorConcealment {
+					// Without concealment, a frame may be lost with its data.
+					if !errors.Is(err, ErrCodecCorruptFrame) {
+						t.Errorf("frame %d: EndFrame = %v, want ErrCodecCorruptFrame", i, err)
+					}
+					continue
+				}
+				if err != nil || len(got) != 1 {
+					t.Fatalf("frame %d: EndFrame = %d frames, %v", i, len(got), err)
+				}
+				switch info := got[0].Info(); {
+				case i < 2 || i >= keyframe:
+					if info.Corrupted || !equalImages(got[0].Image(), want[i].Image()) {
+						t.Errorf("frame %d: corrupted %v or differs from the lossless decode", i, info.Corrupted)
+					}
+				case !info.Corrupted:
+					t.Errorf("frame %d after lost data is not reported as corrupted", i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package vpx
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../include
+#cgo LDFLAGS: -L${SRCDIR}/../lib -lvpx
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"fmt"
+	"math/bits"
+	"sync"
+	"unsafe"
+)
+
+// minFrameBufferSize is the smallest bucket of a FrameBufferPool.
+const minFrameBufferSize = 64 << 10
+
+// FrameBufferPool supplies the frame buffers of VP9 decoders created with
+// DecoderOptions.FrameBuffers. Buffers are allocated in C memory, so libvpx
+// may keep them across calls, and are sized in power-of-two buckets so that
+// they are reused as the stream resolution changes.
+//
+// Each buffer is reference-counted: the decoder holds it while the frame
+// may still be referenced by later frames, and every Frame.Retain holds it
+// until Frame.Release. A buffer is reused once all references are gone.
+// A pool may be shared by several decoders and is safe for concurrent use.
+type FrameBufferPool struct {
+	mu sync.Mutex
+	// buffers indexes every allocated buffer by the address of its data,
+	// which is also the fb_priv libvpx attaches to images in it.
+	buffers map[unsafe.Pointer]*frameBuffer
+	// free holds the unreferenced buffers of each bucket size.
+	free   map[int][]*frameBuffer
+	bytes  int
+	closed bool
+}
+
+type frameBuffer struct {
+	pool *FrameBufferPool
+	data unsafe.Pointer
+	size int
+	refs int
+	// owner is the decoder context holding a reference, nil if none.
+	owner *CodecCtx
+}
+
+// FrameBufferPoolStats describes the buffers of a FrameBufferPool.
+type FrameBufferPoolStats struct {
+	// Buffers is the number of buffers allocated, InUse the number of them
+	// referenced by a decoder or a retained frame.
+	Buffers, InUse int
+	// Bytes is the total size of the allocated buffers.
+	Bytes int
+}
+
+// NewFrameBufferPool returns an empty pool. Release its memory with Close.
+func NewFrameBufferPool() *FrameBufferPool {
+	return &FrameBufferPool{
+		buffers: make(map[unsafe.Pointer]*frameBuffer),
+		free:    make(map[int][]*frameBuffer),
+	}
+}
+
+// Stats returns the current buffer counts of the pool.
+func (p *FrameBufferPool) Stats() FrameBufferPoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := FrameBufferPoolStats{Buffers: len(p.buffers), Bytes: p.bytes}
+	for _, b := range p.buffers {
+		if b.refs > 0 {
+			stats.InUse++
+		}
+	}
+	return stats
+}
+
+// Close frees the buffers not in use. Buffers still referenced are freed
+// as soon as they are released. Decoders must not be created with a closed
+// pool.
+func (p *FrameBufferPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for size, free := range p.free {
+		for _, b := range free {
+			p.freeBuffer(b)
+		}
+		delete(p.free, size)
+	}
+}
+
+func bucketSize(minSize int) int {
+	if minSize <= minFrameBufferSize {
+		return minFrameBufferSize
+	}
+	return 1 << bits.Len(uint(minSize-1))
+}
+
+// attach makes the pool the frame buffer allocator of the decoder ctx.
+func (p *FrameBufferPool) attach(ctx *CodecCtx) error {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return fmt.Errorf("%w: frame buffer pool is closed", ErrCodecInvalidParam)
+	}
+	get := func(minSize int, fb *CodecFrameBuffer) int {
+		return p.get(ctx, minSize, fb)
+	}
+	release := func(fb *CodecFrameBuffer) int {
+		return p.release(ctx, fb)
+	}
+	return codecError(ctx, "set frame buffer functions", SetFrameBufferCallbacks(ctx, get, release))
+}
+
+// detach drops the references the destroyed decoder ctx still holds:
+// libvpx does not release every buffer when it is destroyed.
+func (p *FrameBufferPool) detach(ctx *CodecCtx) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, b := range p.buffers {
+		if b.owner == ctx {
+			b.owner = nil
+			p.unref(b)
+		}
+	}
+}
+
+func (p *FrameBufferPool) get(ctx *CodecCtx, minSize int, fb *CodecFrameBuffer) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	size := bucketSize(minSize)
+	var b *frameBuffer
+	if free := p.free[size]; len(free) > 0 {
+		b = free[len(free)-1]
+		p.free[size] = free[:len(free)-1]
+	} else {
+		// calloc zeroes new buffers as libvpx requires. Like vpxdec, reused
+		// buffers are not cleared again.
+		data := C.calloc(1, C.size_t(size))
+		if data == nil {
+			return -1
+		}
+		b = &frameBuffer{pool: p, data: data, size: size}
+		p.buffers[data] = b
+		p.bytes += size
+	}
+	b.refs = 1
+	b.owner = ctx
+	fb.Data = unsafe.Slice((*byte)(b.data), size)
+	fb.Priv = b.data
+	return 0
+}
+
+func (p *FrameBufferPool) release(ctx *CodecCtx, fb *CodecFrameBuffer) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b, ok := p.buffers[fb.Priv]
+	if !ok || b.owner != ctx {
+		return -1
+	}
+	b.owner = nil
+	p.unref(b)
+	return 0
+}
+
+// retain adds a reference to the buffer an image returned by the decoder
+// lives in, identified by the image's fb_priv.
+func (p *FrameBufferPool) retain(priv unsafe.Pointer) (*frameBuffer, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b, ok := p.buffers[priv]
+	if !ok || b.refs == 0 {
+		return nil, false
+	}
+	b.refs++
+	return b, true
+}
+
+func (b *frameBuffer) release() {
+	b.pool.mu.Lock()
+	defer b.pool.mu.Unlock()
+	b.pool.unref(b)
+}
+
+// unref drops one reference to b. p.mu must be held.
+func (p *FrameBufferPool) unref(b *frameBuffer) {
+	b.refs--
+	if b.refs > 0 {
+		return
+	}
+	if p.closed {
+		p.freeBuffer(b)
+		return
+	}
+	p.free[b.size] = append(p.free[b.size], b)
+}
+
+// freeBuffer returns the memory of b to C. p.mu must be held.
+func (p *FrameBufferPool) freeBuffer(b *frameBuffer) {
+	delete(p.buffers, b.data)
+	p.bytes -= b.size
+	C.free(b.data)
+	b.data = nil
+}
+
+// Retain returns a frame that shares the image of f without copying and
+// stays valid after further decoder calls, until Release. f must be a valid
+// frame of a decoder created with DecoderOptions.FrameBuffers. Retaining a
+// retained frame adds another reference.
+func (f *Frame) Retain() (*Frame, error) {
+	if !f.Valid() {
+		return nil, fmt.Errorf("%w: retain: frame is no longer valid", ErrCodecInvalidParam)
+	}
+	var pool *FrameBufferPool
+	switch {
+	case f.buf != nil:
+		pool = f.buf.pool
+	case f.dec != nil:
+		pool = f.dec.frameBuffers
+	}
+	if pool == nil {
+		return nil, fmt.Errorf("%w: retain: frame is not backed by a FrameBufferPool", ErrCodecInvalidParam)
+	}
+	buf, ok := pool.retain(f.img.FbPriv)
+	if !ok {
+		return nil, fmt.Errorf("%w: retain: frame image is not in a pool buffer", ErrCodecInvalidParam)
+	}
+	img := imageHeader(f.img)
+	img.Planes = f.img.Planes
+	img.FbPriv = f.img.FbPriv
+	return &Frame{img: img, info: f.info, buf: buf}, nil
+}
+
+// Release drops the reference a retained frame holds on its buffer and
+// invalidates the frame. It does nothing for other frames.
+func (f *Frame) Release() {
+	if f.buf == nil {
+		return
+	}
+	f.buf.release()
+	f.buf = nil
+	f.img = nil
+}
@@ -0,0 +1,204 @@
+package vpx
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBucketSize(t *testing.T) {
+	tests := []struct{ min, want int }{
+		{1, minFrameBufferSize},
+		{minFrameBufferSize, minFrameBufferSize},
+		{minFrameBufferSize + 1, 2 * minFrameBufferSize},
+		{175135, 256 << 10},
+		{1 << 20, 1 << 20},
+	}
+	for _, tt := range tests {
+		if got := bucketSize(tt.min); got != tt.want {
+			t.Errorf("bucketSize(%d) = %d, want %d", tt.min, got, tt.want)
+		}
+	}
+}
+
+// decodeVP9Reference decodes packets with a default decoder and returns
+// copies of the frames.
+func decodeVP9Reference(t *testing.T, packets []Packet) []*Frame {
+	t.Helper()
+	dec, err := NewDecoder(CodecVP9, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer dec.Close()
+	var frames []*Frame
+	for _, p := range packets {
+		got, err := dec.Decode(p.Data)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		for _, f := range got {
+			frames = append(frames, f.Clone())
+		}
+	}
+	return frames
+}
+
+func TestFrameBufferPoolRetain(t *testing.T) {
+	packets := encodeTestPackets(t, CodecVP9, 320, 240, 6)
+	want := decodeVP9Reference(t, packets)
+
+	pool := NewFrameBufferPool()
+	defer pool.Close()
+	dec, err := NewDecoder(CodecVP9, DecoderOptions{FrameBuffers: pool})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	var retained []*Frame
+	for _, p := range packets {
+		frames, err := dec.Decode(p.Data)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		for _, f := range frames {
+			r, err := f.Retain()
+			if err != nil {
+				t.Fatalf("Retain failed: %v", err)
+			}
+			if r.Image().Planes[PlaneY] != f.Image().Planes[PlaneY] {
+				t.Error("retained frame does not share the decoded image")
+			}
+			if r.Borrowed() {
+				t.Error("retained frame is borrowed")
+			}
+			retained = append(retained, r)
+		}
+	}
+	if len(retained) != len(want) {
+		t.Fatalf("decoded %d frames, want %d", len(retained), len(want))
+	}
+	dec.Close()
+
+	// Every frame keeps its own buffer after the decoder is gone.
+	stats := pool.Stats()
+	if stats.InUse != len(retained) {
+		t.Errorf("%d buffers in use, want one per retained frame (%d)", stats.InUse, len(retained))
+	}
+	for i, r := range retained {
+		if !r.Valid() || !equalImages(r.Image(), want[i].Image()) {
+			t.Errorf("retained frame %d differs from the default decode", i)
+		}
+	}
+
+	extra, err := retained[0].Retain()
+	if err != nil {
+		t.Fatalf("Retain of a retained frame failed: %v", err)
+	}
+	for _, r := range retained {
+		r.Release()
+		if r.Valid() {
+			t.Error("frame still valid after Release")
+		}
+	}
+	if got := pool.Stats().InUse; got != 1 {
+		t.Errorf("%d buffers in use, want 1 held by the extra reference", got)
+	}
+	if !equalImages(extra.Image(), want[0].Image()) {
+		t.Error("second reference to frame 0 changed after the first was released")
+	}
+	extra.Release()
+	if got := pool.Stats().InUse; got != 0 {
+		t.Errorf("%d buffers in use after releasing every frame", got)
+	}
+
+	// A second decoder reuses the idle buffers.
+	dec, err = NewDecoder(CodecVP9, DecoderOptions{FrameBuffers: pool})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	for i, p := range packets {
+		frames, err := dec.Decode(p.Data)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if len(frames) == 1 && !equalImages(frames[0].Image(), want[i].Image()) {
+			t.Errorf("frame %d from reused buffers differs from the default decode", i)
+		}
+	}
+	dec.Close()
+	if got := pool.Stats(); got.Buffers != stats.Buffers || got.InUse != 0 {
+		t.Errorf("after reuse: %+v, want %d idle buffers", got, stats.Buffers)
+	}
+}
+
+func TestFrameBufferPoolClose(t *testing.T) {
+	packets := encodeTestPackets(t, CodecVP9, 320, 240, 2)
+	pool := NewFrameBufferPool()
+	dec, err := NewDecoder(CodecVP9, DecoderOptions{FrameBuffers: pool})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	frames, err := dec.Decode(packets[0].Data)
+	if err != nil || len(frames) != 1 {
+		t.Fatalf("Decode = %d frames, %v", len(frames), err)
+	}
+	r, err := frames[0].Retain()
+	if err != nil {
+		t.Fatalf("Retain failed: %v", err)
+	}
+	dec.Close()
+
+	pool.Close()
+	if got := pool.Stats(); got.Buffers != 1 || got.InUse != 1 {
+		t.Errorf("closed pool with one retained frame: %+v, want one buffer in use", got)
+	}
+	if r.Width() != 320 || r.Height() != 240 {
+		t.Errorf("retained frame is %dx%d, want 320x240", r.Width(), r.Height())
+	}
+	r.Release()
+	if got := pool.Stats(); got.Buffers != 0 || got.Bytes != 0 {
+		t.Errorf("closed pool after release: %+v, want empty", got)
+	}
+	if r.Width() != 0 || r.Height() != 0 || r.Image() != nil {
+		t.Errorf("released frame is %dx%d, want 0x0 and no image", r.Width(), r.Height())
+	}
+	if _, err := NewDecoder(CodecVP9, DecoderOptions{FrameBuffers: pool}); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("NewDecoder with closed pool = %v, want ErrCodecInvalidParam", err)
+	}
+}
+
+func TestFrameBufferPoolErrors(t *testing.T) {
+	pool := NewFrameBufferPool()
+	defer pool.Close()
+	if CodecGetCaps(DecoderFor(int(CodecVP8)))&CodecCapExternalFrameBuffer == 0 {
+		if _, err := NewDecoder(CodecVP8, DecoderOptions{FrameBuffers: pool}); !errors.Is(err, ErrCodecIncapable) {
+			t.Errorf("VP8 FrameBuffers = %v, want ErrCodecIncapable", err)
+		}
+	}
+
+	packets := encodeTestPackets(t, CodecVP9, 320, 240, 2)
+	dec, err := NewDecoder(CodecVP9, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer dec.Close()
+	frames, err := dec.Decode(packets[0].Data)
+	if err != nil || len(frames) != 1 {
+		t.Fatalf("Decode = %d frames, %v", len(frames), err)
+	}
+	if _, err := frames[0].Retain(); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("Retain without a pool = %v, want ErrCodecInvalidParam", err)
+	}
+	clone := frames[0].Clone()
+	if _, err := clone.Retain(); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("Retain of a clone = %v, want ErrCodecInvalidParam", err)
+	}
+	clone.Release()
+	if !clone.Valid() {
+		t.Error("Release invalidated a frame that was not retained")
+	}
+	if _, err := dec.Decode(packets[1].Data); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if _, err := frames[0].Retain(); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("Retain of an invalidated frame = %v, want ErrCodecInvalidParam", err)
+	}
+}
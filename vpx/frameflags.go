@@ -0,0 +1,125 @@
+package vpx
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../include
+#cgo LDFLAGS: -L${SRCDIR}/../lib -lvpx
+#include <vpx/vp8cx.h>
+*/
+import "C"
+
+// RefFrameType identifies the reference buffers of an encoder or decoder.
+// Values may be combined.
+type RefFrameType int
+
+const (
+	RefLast   RefFrameType = C.VP8_LAST_FRAME
+	RefGolden RefFrameType = C.VP8_GOLD_FRAME
+	RefAltRef RefFrameType = C.VP8_ALTR_FRAME
+	// RefAll combines every reference buffer.
+	RefAll = RefLast | RefGolden | RefAltRef
+)
+
+// Per-frame flags for Encoder.Encode and Encoder.SetFrameFlags that control
+// which reference buffers a frame predicts from and refreshes. They are
+// honored by VP8 and VP9.
+const (
+	// EflagNoRefLast stops the frame predicting from the last frame.
+	EflagNoRefLast EncFrameFlags = C.VP8_EFLAG_NO_REF_LAST
+	// EflagNoRefGF stops the frame predicting from the golden frame.
+	EflagNoRefGF EncFrameFlags = C.VP8_EFLAG_NO_REF_GF
+	// EflagNoRefARF stops the frame predicting from the alt-ref frame.
+	EflagNoRefARF EncFrameFlags = C.VP8_EFLAG_NO_REF_ARF
+	// EflagNoUpdLast keeps the frame out of the last frame buffer.
+	EflagNoUpdLast EncFrameFlags = C.VP8_EFLAG_NO_UPD_LAST
+	// EflagNoUpdGF keeps the frame out of the golden frame buffer.
+	EflagNoUpdGF EncFrameFlags = C.VP8_EFLAG_NO_UPD_GF
+	// EflagNoUpdARF keeps the frame out of the alt-ref frame buffer.
+	EflagNoUpdARF EncFrameFlags = C.VP8_EFLAG_NO_UPD_ARF
+	// EflagForceGF copies the frame into the golden frame buffer.
+	EflagForceGF EncFrameFlags = C.VP8_EFLAG_FORCE_GF
+	// EflagForceARF copies the frame into the alt-ref frame buffer.
+	EflagForceARF EncFrameFlags = C.VP8_EFLAG_FORCE_ARF
+	// EflagNoUpdEntropy keeps the frame from updating the entropy model, so
+	// that later frames still decode if this one is lost.
+	EflagNoUpdEntropy EncFrameFlags = C.VP8_EFLAG_NO_UPD_ENTROPY
+)
+
+// refFlags maps each reference buffer to its no-reference, no-update and
+// force-update flags.
+var refFlags = []struct {
+	ref                 RefFrameType
+	noRef, noUpd, force EncFrameFlags
+}{
+	{RefLast, EflagNoRefLast, EflagNoUpdLast, 0},
+	{RefGolden, EflagNoRefGF, EflagNoUpdGF, EflagForceGF},
+	{RefAltRef, EflagNoRefARF, EflagNoUpdARF, EflagForceARF},
+}
+
+// NoReference returns f with prediction from refs disabled.
+func (f EncFrameFlags) NoReference(refs RefFrameType) EncFrameFlags {
+	for _, r := range refFlags {
+		if refs&r.ref != 0 {
+			f |= r.noRef
+		}
+	}
+	return f
+}
+
+// ReferenceOnly returns f with prediction restricted to refs.
+func (f EncFrameFlags) ReferenceOnly(refs RefFrameType) EncFrameFlags {
+	for _, r := range refFlags {
+		if refs&r.ref != 0 {
+			f &^= r.noRef
+		} else {
+			f |= r.noRef
+		}
+	}
+	return f
+}
+
+// NoUpdate returns f with the refresh of refs disabled.
+func (f EncFrameFlags) NoUpdate(refs RefFrameType) EncFrameFlags {
+	for _, r := range refFlags {
+		if refs&r.ref != 0 {
+			f |= r.noUpd
+			f &^= r.force
+		}
+	}
+	return f
+}
+
+// UpdateOnly returns f with the refresh restricted to refs. Whether the
+// golden and alt-ref frames in refs are refreshed is left to the encoder;
+// use ForceUpdate to refresh them unconditionally.
+func (f EncFrameFlags) UpdateOnly(refs RefFrameType) EncFrameFlags {
+	return f.NoUpdate(RefAll &^ refs).allowUpdate(refs)
+}
+
+// ForceUpdate returns f with refs refreshed by the frame.
+func (f EncFrameFlags) ForceUpdate(refs RefFrameType) EncFrameFlags {
+	for _, r := range refFlags {
+		if refs&r.ref != 0 {
+			f = f.allowUpdate(r.ref) | r.force
+		}
+	}
+	return f
+}
+
+func (f EncFrameFlags) allowUpdate(refs RefFrameType) EncFrameFlags {
+	for _, r := range refFlags {
+		if refs&r.ref != 0 {
+			f &^= r.noUpd
+		}
+	}
+	return f
+}
+
+// NoEntropyUpdate returns f with EflagNoUpdEntropy set.
+func (f EncFrameFlags) NoEntropyUpdate() EncFrameFlags {
+	return f | EflagNoUpdEntropy
+}
+
+// ForceKeyframe returns f with EflagForceKf set.
+func (f EncFrameFlags) ForceKeyframe() EncFrameFlags {
+	return f | EflagForceKf
+}
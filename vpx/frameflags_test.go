@@ -0,0 +1,118 @@
+package vpx
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestEncFrameFlagsBuilder(t *testing.T) {
+	tests := []struct {
+		name string
+		got  EncFrameFlags
+		want EncFrameFlags
+	}{
+		{"no reference", EncFrameFlags(0).NoReference(RefLast | RefAltRef), EflagNoRefLast | EflagNoRefARF},
+		{"reference only", EncFrameFlags(0).ReferenceOnly(RefGolden), EflagNoRefLast | EflagNoRefARF},
+		{"reference only clears", EncFrameFlags(0).NoReference(RefAll).ReferenceOnly(RefLast), EflagNoRefGF | EflagNoRefARF},
+		{"no update", EncFrameFlags(0).NoUpdate(RefGolden), EflagNoUpdGF},
+		{"update only", EncFrameFlags(0).UpdateOnly(RefLast), EflagNoUpdGF | EflagNoUpdARF},
+		{"update only clears", EncFrameFlags(0).NoUpdate(RefAll).UpdateOnly(RefGolden), EflagNoUpdLast | EflagNoUpdARF},
+		{"force update", EncFrameFlags(0).NoUpdate(RefAll).ForceUpdate(RefGolden | RefAltRef), EflagNoUpdLast | EflagForceGF | EflagForceARF},
+		{"no update clears force", EncFrameFlags(0).ForceUpdate(RefGolden).NoUpdate(RefGolden), EflagNoUpdGF},
+		{"entropy", EncFrameFlags(0).NoEntropyUpdate(), EflagNoUpdEntropy},
+		{"keyframe", EncFrameFlags(0).ForceKeyframe(), EflagForceKf},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: flags = %#x, want %#x", tt.name, int(tt.got), int(tt.want))
+		}
+	}
+}
+
+func TestEncoderRecoveryFrame(t *testing.T) {
+	for _, codec := range []Codec{CodecVP8, CodecVP9} {
+		t.Run(codec.String(), func(t *testing.T) {
+			enc, err := NewEncoder(codec, EncoderOptions{
+				Width:    320,
+				Height:   240,
+				Bitrate:  500,
+				Deadline: DlRealtime,
+				// VP9 otherwise predicts motion vectors from the previously
+				// decoded frame, which differs after a loss.
+				ErrorResilient: ErrorResilientDefault,
+				Configure: func(cfg *CodecEncCfg) {
+					cfg.GLagInFrames = 0
+				},
+			})
+			if err != nil {
+				t.Fatalf("NewEncoder failed: %v", err)
+			}
+			defer enc.Close()
+
+			full, err := NewDecoder(codec, DecoderOptions{})
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			defer full.Close()
+			lossy, err := NewDecoder(codec, DecoderOptions{})
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			defer lossy.Close()
+
+			img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+			defer ImageFree(img)
+			img.Deref()
+
+			// The keyframe stays in the golden buffer; frames 3 to 5 are lost.
+			keepGolden := EncFrameFlags(0).NoUpdate(RefGolden | RefAltRef)
+			for i := 0; i < 8; i++ {
+				if i == 6 {
+					if err := enc.RequestRecoveryFrame(RefGolden); err != nil {
+						t.Fatalf("RequestRecoveryFrame failed: %v", err)
+					}
+				}
+				fillTestPattern(img, i)
+				pkts, err := enc.Encode(img, CodecPts(i), keepGolden)
+				if err != nil {
+					t.Fatalf("Encode frame %d failed: %v", i, err)
+				}
+				if len(pkts) != 1 {
+					t.Fatalf("frame %d: got %d packets, want 1", i, len(pkts))
+				}
+				if i > 0 && pkts[0].IsKeyframe() {
+					t.Fatalf("frame %d is a keyframe", i)
+				}
+
+				want, err := full.Decode(pkts[0].Data)
+				if err != nil || len(want) != 1 {
+					t.Fatalf("frame %d: full decode = %d frames, %v", i, len(want), err)
+				}
+				if i >= 3 && i <= 5 {
+					continue
+				}
+				got, err := lossy.Decode(pkts[0].Data)
+				if err != nil || len(got) != 1 {
+					t.Fatalf("frame %d: lossy decode = %d frames, %v", i, len(got), err)
+				}
+				if i >= 6 && !bytes.Equal(visiblePlane(got[0].Image(), 0), visiblePlane(want[0].Image(), 0)) {
+					t.Errorf("frame %d differs from the lossless decode", i)
+				}
+			}
+		})
+	}
+}
+
+func TestEncoderRecoveryFrameErrors(t *testing.T) {
+	enc := newTestEncoder(t, CodecVP8)
+	for _, refs := range []RefFrameType{0, RefAll + 1} {
+		if err := enc.RequestRecoveryFrame(refs); !errors.Is(err, ErrCodecInvalidParam) {
+			t.Errorf("RequestRecoveryFrame(%#x) = %v, want ErrCodecInvalidParam", int(refs), err)
+		}
+	}
+	enc.Close()
+	if err := enc.RequestRecoveryFrame(RefGolden); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("closed: RequestRecoveryFrame = %v, want ErrCodecClosed", err)
+	}
+}
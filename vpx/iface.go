@@ -52,3 +52,11 @@ func EncoderFor(fourcc int) *CodecIface {
 	}
 	return nil
 }
+
+// Codec identifies a VP8 or VP9 codec by its fourcc.
+type Codec int
+
+const (
+	CodecVP8 Codec = Vp8Fourcc
+	CodecVP9 Codec = Vp9Fourcc
+)
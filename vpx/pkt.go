@@ -27,6 +27,14 @@ static unsigned long get_cx_pkt_frame_duration(const vpx_codec_cx_pkt_t* pkt) {
 static vpx_codec_frame_flags_t get_cx_pkt_frame_flags(const vpx_codec_cx_pkt_t* pkt) {
 	return pkt->data.frame.flags;
 }
+
+static void* get_cx_pkt_twopass_stats_buf(const vpx_codec_cx_pkt_t* pkt) {
+	return pkt->data.twopass_stats.buf;
+}
+
+static size_t get_cx_pkt_twopass_stats_sz(const vpx_codec_cx_pkt_t* pkt) {
+	return pkt->data.twopass_stats.sz;
+}
 */
 import "C"
 import "unsafe"
@@ -69,6 +77,20 @@ func (pkt *CodecCxPkt) GetFrameFlags() CodecFrameFlags {
 	return CodecFrameFlags(C.get_cx_pkt_frame_flags(pkt.refa671fc83))
 }
 
+// GetTwopassStats returns the first pass statistics from a CodecStatsPkt.
+// Returns nil if the packet is nil or holds no statistics.
+func (pkt *CodecCxPkt) GetTwopassStats() []byte {
+	if pkt == nil || pkt.refa671fc83 == nil {
+		return nil
+	}
+	buf := C.get_cx_pkt_twopass_stats_buf(pkt.refa671fc83)
+	sz := C.get_cx_pkt_twopass_stats_sz(pkt.refa671fc83)
+	if buf == nil || sz == 0 {
+		return nil
+	}
+	return C.GoBytes(buf, C.int(sz))
+}
+
 // IsKeyframe returns true if the frame is a keyframe.
 func (pkt *CodecCxPkt) IsKeyframe() bool {
 	return pkt.GetFrameFlags()&FrameIsKey != 0
@@ -0,0 +1,78 @@
+package vpx
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../include
+#cgo LDFLAGS: -L${SRCDIR}/../lib -lvpx
+#include <vpx/vp8dx.h>
+*/
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+// PostprocFlags selects the post-processing filters of the VP8 decoder.
+// Values may be combined.
+type PostprocFlags int
+
+const (
+	PostprocNone         PostprocFlags = C.VP8_NOFILTERING
+	PostprocDeblock      PostprocFlags = C.VP8_DEBLOCK
+	PostprocDemacroblock PostprocFlags = C.VP8_DEMACROBLOCK
+	PostprocAddNoise     PostprocFlags = C.VP8_ADDNOISE
+	PostprocMFQE         PostprocFlags = C.VP8_MFQE
+)
+
+// maxPostprocLevel is the highest deblocking and noise level.
+const maxPostprocLevel = 16
+
+// PostprocConfig configures decoder post-processing, as used by VP8SetPostproc.
+// For the best PSNR use PostprocDeblock with a DeblockingLevel of 1.
+type PostprocConfig struct {
+	Flags PostprocFlags
+	// DeblockingLevel is the deblocking and demacroblocking strength, 0..16.
+	DeblockingLevel int
+	// NoiseLevel is the strength of the noise PostprocAddNoise adds, 0..16.
+	NoiseLevel int
+}
+
+// Validate checks the configuration against the limits of libvpx.
+func (c PostprocConfig) Validate() error {
+	all := PostprocDeblock | PostprocDemacroblock | PostprocAddNoise | PostprocMFQE
+	if c.Flags&^all != 0 {
+		return fmt.Errorf("%w: unknown postproc flags %#x", ErrCodecInvalidParam, int(c.Flags&^all))
+	}
+	if err := checkRange("deblocking level", c.DeblockingLevel, 0, maxPostprocLevel); err != nil {
+		return err
+	}
+	return checkRange("noise level", c.NoiseLevel, 0, maxPostprocLevel)
+}
+
+// CodecControlPostproc applies VP8SetPostproc.
+func CodecControlPostproc(ctx *CodecCtx, c PostprocConfig) CodecErr {
+	cfg := C.vp8_postproc_cfg_t{
+		post_proc_flag:   C.int(c.Flags),
+		deblocking_level: C.int(c.DeblockingLevel),
+		noise_level:      C.int(c.NoiseLevel),
+	}
+	return CodecControlPtr(ctx, VP8SetPostproc, unsafe.Pointer(&cfg))
+}
+
+// SetPostproc sets the post-processing applied to the frames returned by
+// the following Decode calls. The decoder must have been created with
+// DecoderOptions.Postproc, which only VP8 supports.
+func (d *Decoder) SetPostproc(c PostprocConfig) error {
+	if CodecGetCaps(DecoderFor(int(d.codec)))&CodecCapPostproc == 0 {
+		return fmt.Errorf("%w: postproc is not supported by %s", ErrCodecIncapable, d.codec)
+	}
+	if !d.postproc {
+		return fmt.Errorf("%w: decoder was created without postproc", ErrCodecInvalidParam)
+	}
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if d.ctx == nil {
+		return ErrCodecClosed
+	}
+	return codecError(d.ctx, "set postproc", CodecControlPostproc(d.ctx, c))
+}
@@ -0,0 +1,126 @@
+package vpx
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestPostprocConfigValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  PostprocConfig
+		want error
+	}{
+		{"zero", PostprocConfig{}, nil},
+		{"all", PostprocConfig{Flags: PostprocDeblock | PostprocDemacroblock | PostprocAddNoise | PostprocMFQE, DeblockingLevel: 16, NoiseLevel: 16}, nil},
+		{"unknown flag", PostprocConfig{Flags: PostprocMFQE << 1}, ErrCodecInvalidParam},
+		{"deblocking level", PostprocConfig{Flags: PostprocDeblock, DeblockingLevel: 17}, ErrCodecInvalidParam},
+		{"noise level", PostprocConfig{Flags: PostprocAddNoise, NoiseLevel: -1}, ErrCodecInvalidParam},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+			t.Errorf("%s: Validate = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestDecoderPostproc(t *testing.T) {
+	enc, err := NewEncoder(CodecVP8, EncoderOptions{
+		Width:   320,
+		Height:  240,
+		Bitrate: 30,
+		Configure: func(cfg *CodecEncCfg) {
+			cfg.GLagInFrames = 0
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	defer enc.Close()
+
+	plain, err := NewDecoder(CodecVP8, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer plain.Close()
+	pp, err := NewDecoder(CodecVP8, DecoderOptions{Postproc: true})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer pp.Close()
+
+	img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+	defer ImageFree(img)
+	img.Deref()
+
+	configs := []PostprocConfig{
+		{},
+		{Flags: PostprocDeblock | PostprocDemacroblock, DeblockingLevel: 12},
+		{},
+		{Flags: PostprocAddNoise, NoiseLevel: 8},
+	}
+	for i := 0; i < 8; i++ {
+		fillNoise(img, int64(i))
+		pkts, err := enc.Encode(img, CodecPts(i), 0)
+		if err != nil {
+			t.Fatalf("Encode frame %d failed: %v", i, err)
+		}
+		if len(pkts) != 1 {
+			t.Fatalf("frame %d: got %d packets, want 1", i, len(pkts))
+		}
+
+		want, err := plain.Decode(pkts[0].Data)
+		if err != nil || len(want) != 1 {
+			t.Fatalf("frame %d: decode = %d frames, %v", i, len(want), err)
+		}
+		cfg := configs[i%len(configs)]
+		if err := pp.SetPostproc(cfg); err != nil {
+			t.Fatalf("SetPostproc failed: %v", err)
+		}
+		got, err := pp.Decode(pkts[0].Data)
+		if err != nil || len(got) != 1 {
+			t.Fatalf("frame %d: postproc decode = %d frames, %v", i, len(got), err)
+		}
+
+		// Post-processing only alters the output, never the references.
+		same := bytes.Equal(visiblePlane(got[0].Image(), 0), visiblePlane(want[0].Image(), 0))
+		if filtered := cfg.Flags != PostprocNone; same == filtered {
+			t.Errorf("frame %d: flags %#x, output equal to unfiltered decode = %v", i, int(cfg.Flags), same)
+		}
+	}
+}
+
+func TestDecoderPostprocErrors(t *testing.T) {
+	vp9, err := NewDecoder(CodecVP9, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer vp9.Close()
+	if CodecGetCaps(DecoderFor(int(CodecVP9)))&CodecCapPostproc == 0 {
+		if err := vp9.SetPostproc(PostprocConfig{}); !errors.Is(err, ErrCodecIncapable) {
+			t.Errorf("VP9 SetPostproc = %v, want ErrCodecIncapable", err)
+		}
+	}
+
+	dec, err := NewDecoder(CodecVP8, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer dec.Close()
+	if err := dec.SetPostproc(PostprocConfig{Flags: PostprocDeblock}); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("SetPostproc without Postproc = %v, want ErrCodecInvalidParam", err)
+	}
+
+	pp, err := NewDecoder(CodecVP8, DecoderOptions{Postproc: true})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	if err := pp.SetPostproc(PostprocConfig{Flags: PostprocDeblock, DeblockingLevel: 20}); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("SetPostproc(level 20) = %v, want ErrCodecInvalidParam", err)
+	}
+	pp.Close()
+	if err := pp.SetPostproc(PostprocConfig{}); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("closed: SetPostproc = %v, want ErrCodecClosed", err)
+	}
+}
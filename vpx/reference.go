@@ -0,0 +1,199 @@
+package vpx
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../include
+#cgo LDFLAGS: -L${SRCDIR}/../lib -lvpx
+#include <vpx/vp8.h>
+*/
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+// refFrameBuffers is the number of VP9 reference buffers VP9GetReference
+// addresses.
+const refFrameBuffers = 8
+
+// CodecControlReference passes ref and img to VP8SetReference or
+// VP8CopyReference. img must be allocated by ImageAlloc and match the coded
+// frame size.
+func CodecControlReference(ctx *CodecCtx, ctrlID int, ref RefFrameType, img *Image) CodecErr {
+	cimg, allocs := img.PassValue()
+	if allocs != nil {
+		defer allocs.Free()
+	}
+	cref := C.vpx_ref_frame_t{
+		frame_type: C.vpx_ref_frame_type_t(ref),
+		img:        cimg,
+	}
+	return CodecControlPtr(ctx, ctrlID, unsafe.Pointer(&cref))
+}
+
+// CodecControlGetReferenceVP9 reads VP9GetReference for buffer idx, 0..7.
+// The returned image references decoder memory and is only valid until the
+// next decode call.
+func CodecControlGetReferenceVP9(ctx *CodecCtx, idx int) (*Image, CodecErr) {
+	cref := C.vp9_ref_frame_t{idx: C.int(idx)}
+	if err := CodecControlPtr(ctx, VP9GetReference, unsafe.Pointer(&cref)); err != CodecOk {
+		return nil, err
+	}
+	img := NewImageRef(unsafe.Pointer(&cref.img))
+	img.Deref()
+	return img, CodecOk
+}
+
+func checkRefFrame(ref RefFrameType) error {
+	switch ref {
+	case RefLast, RefGolden, RefAltRef:
+		return nil
+	}
+	return fmt.Errorf("%w: reference frame %#x is not one of RefLast, RefGolden or RefAltRef", ErrCodecInvalidParam, int(ref))
+}
+
+// referenceImage allocates an I420 image with the padded size libvpx uses
+// for the reference buffers of a width x height codec: 16-pixel macroblocks
+// for VP8 and 8-pixel blocks for VP9. Planes are allocated without stride
+// padding, because libvpx treats any padding as a border it may extend.
+func referenceImage(codec Codec, width, height uint32) (*Image, error) {
+	align := uint32(ROIBlockSize(codec))
+	img := ImageAlloc(nil, ImageFormatI420, (width+align-1)&^(align-1), (height+align-1)&^(align-1), 1)
+	if img == nil {
+		return nil, ErrCodecMemError
+	}
+	img.Deref()
+	return img, nil
+}
+
+// copyReference returns a Go-owned copy of reference buffer ref of a
+// width x height codec.
+func copyReference(ctx *CodecCtx, codec Codec, ref RefFrameType, width, height uint32) (*Image, error) {
+	if err := checkRefFrame(ref); err != nil {
+		return nil, err
+	}
+	img, err := referenceImage(codec, width, height)
+	if err != nil {
+		return nil, err
+	}
+	defer ImageFree(img)
+	if err := codecError(ctx, "copy reference", CodecControlReference(ctx, VP8CopyReference, ref, img)); err != nil {
+		return nil, err
+	}
+	img.DW, img.DH = width, height
+	return cloneImage(img), nil
+}
+
+// setReference replaces reference buffer ref of a width x height codec
+// with a copy of img.
+func setReference(ctx *CodecCtx, codec Codec, ref RefFrameType, img *Image, width, height uint32) error {
+	if err := checkRefFrame(ref); err != nil {
+		return err
+	}
+	if img == nil {
+		return fmt.Errorf("%w: nil image", ErrCodecInvalidParam)
+	}
+	if img.Fmt != ImageFormatI420 || img.DW != width || img.DH != height {
+		return fmt.Errorf("%w: reference image is %dx%d format %#x, want %dx%d I420",
+			ErrCodecInvalidParam, img.DW, img.DH, int(img.Fmt), width, height)
+	}
+	// Copy into C memory: libvpx reads the planes through a struct that
+	// must not hold Go pointers.
+	cimg, err := referenceImage(codec, width, height)
+	if err != nil {
+		return err
+	}
+	defer ImageFree(cimg)
+	for p := PlaneY; p <= PlaneV; p++ {
+		copyPlanePadded(cimg, img, p)
+	}
+	return codecError(ctx, "set reference", CodecControlReference(ctx, VP8SetReference, ref, cimg))
+}
+
+// copyPlanePadded copies plane p of src into the top-left corner of the
+// larger dst and fills the rest of dst by repeating the last column and row.
+func copyPlanePadded(dst, src *Image, p int) {
+	rows, cols := planeRows(src, p), planeCols(src, p)
+	dstRows, dstCols := planeRows(dst, p), planeCols(dst, p)
+	srcStride, dstStride := int(src.Stride[p]), int(dst.Stride[p])
+	in := unsafe.Slice(src.Planes[p], srcStride*(rows-1)+cols)
+	out := unsafe.Slice(dst.Planes[p], dstStride*(dstRows-1)+dstCols)
+	for row := 0; row < dstRows; row++ {
+		line := out[row*dstStride : row*dstStride+dstCols]
+		if row < rows {
+			copy(line, in[row*srcStride:row*srcStride+cols])
+			for col := cols; col < dstCols; col++ {
+				line[col] = line[cols-1]
+			}
+		} else {
+			copy(line, out[(rows-1)*dstStride:])
+		}
+	}
+}
+
+// CopyReference returns a copy of the encoder's reference buffer ref.
+// The copy is owned by Go and needs no freeing.
+func (e *Encoder) CopyReference(ref RefFrameType) (*Image, error) {
+	if e.ctx == nil {
+		return nil, ErrCodecClosed
+	}
+	return copyReference(e.ctx, e.codec, ref, e.cfg.GW, e.cfg.GH)
+}
+
+// SetReference replaces the encoder's reference buffer ref with img, an
+// I420 image of the configured frame size.
+func (e *Encoder) SetReference(ref RefFrameType, img *Image) error {
+	if e.ctx == nil {
+		return ErrCodecClosed
+	}
+	return setReference(e.ctx, e.codec, ref, img, e.cfg.GW, e.cfg.GH)
+}
+
+// CopyReference returns a copy of the decoder's reference buffer ref at
+// the size of the last decoded frame. The VP9 decoder only copies RefLast;
+// use ReferenceBuffer to read its other buffers. The copy is owned by Go
+// and needs no freeing.
+func (d *Decoder) CopyReference(ref RefFrameType) (*Image, error) {
+	// A failed VP9 copy leaves an error behind that breaks further controls
+	// until the next frame, so reject it here.
+	if d.codec == CodecVP9 && ref != RefLast {
+		return nil, fmt.Errorf("%w: %s decoder only copies the last frame", ErrCodecIncapable, d.codec)
+	}
+	if d.ctx == nil {
+		return nil, ErrCodecClosed
+	}
+	if d.width == 0 {
+		return nil, fmt.Errorf("%w: copy reference: no frame decoded", ErrCodecInvalidParam)
+	}
+	return copyReference(d.ctx, d.codec, ref, d.width, d.height)
+}
+
+// SetReference replaces the decoder's reference buffer ref with img, an
+// I420 image of the size of the last decoded frame.
+func (d *Decoder) SetReference(ref RefFrameType, img *Image) error {
+	if d.ctx == nil {
+		return ErrCodecClosed
+	}
+	if d.width == 0 {
+		return fmt.Errorf("%w: set reference: no frame decoded", ErrCodecInvalidParam)
+	}
+	return setReference(d.ctx, d.codec, ref, img, d.width, d.height)
+}
+
+// ReferenceBuffer returns VP9 reference buffer idx, 0..7, without copying.
+// The frame borrows decoder memory like the frames returned by Decode.
+func (d *Decoder) ReferenceBuffer(idx int) (*Frame, error) {
+	if d.codec != CodecVP9 {
+		return nil, fmt.Errorf("%w: reference buffer is only supported by %s", ErrCodecIncapable, CodecVP9)
+	}
+	if err := checkRange("reference buffer", idx, 0, refFrameBuffers-1); err != nil {
+		return nil, err
+	}
+	if d.ctx == nil {
+		return nil, ErrCodecClosed
+	}
+	img, err := CodecControlGetReferenceVP9(d.ctx, idx)
+	if err := codecError(d.ctx, "get reference", err); err != nil {
+		return nil, err
+	}
+	return &Frame{img: img, dec: d, gen: d.gen}, nil
+}
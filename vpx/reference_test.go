@@ -0,0 +1,292 @@
+package vpx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// equalImages reports whether the visible samples of the Y, U and V planes
+// of a and b are identical.
+func equalImages(a, b *Image) bool {
+	for p := PlaneY; p <= PlaneV; p++ {
+		if !bytes.Equal(visiblePlane(a, p), visiblePlane(b, p)) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCopyReference(t *testing.T) {
+	for _, codec := range []Codec{CodecVP8, CodecVP9} {
+		// 324x244 is not a multiple of the VP8 or VP9 block sizes.
+		for _, size := range [][2]uint32{{320, 240}, {324, 244}} {
+			t.Run(fmt.Sprintf("%s/%dx%d", codec, size[0], size[1]), func(t *testing.T) {
+				width, height := size[0], size[1]
+				enc, err := NewEncoder(codec, EncoderOptions{
+					Width:    width,
+					Height:   height,
+					Deadline: DlRealtime,
+					Configure: func(cfg *CodecEncCfg) {
+						cfg.GLagInFrames = 0
+					},
+				})
+				if err != nil {
+					t.Fatalf("NewEncoder failed: %v", err)
+				}
+				defer enc.Close()
+				dec, err := NewDecoder(codec, DecoderOptions{})
+				if err != nil {
+					t.Fatalf("NewDecoder failed: %v", err)
+				}
+				defer dec.Close()
+
+				img := ImageAlloc(nil, ImageFormatI420, width, height, 1)
+				defer ImageFree(img)
+				img.Deref()
+
+				var last *Frame
+				for i := 0; i < 3; i++ {
+					fillTestPatternForSize(img, i, width, height)
+					pkts, err := enc.Encode(img, CodecPts(i), 0)
+					if err != nil || len(pkts) != 1 {
+						t.Fatalf("Encode frame %d = %d packets, %v", i, len(pkts), err)
+					}
+					frames, err := dec.Decode(pkts[0].Data)
+					if err != nil || len(frames) != 1 {
+						t.Fatalf("Decode frame %d = %d frames, %v", i, len(frames), err)
+					}
+					last = frames[0].Clone()
+				}
+
+				encRef, err := enc.CopyReference(RefLast)
+				if err != nil {
+					t.Fatalf("Encoder.CopyReference failed: %v", err)
+				}
+				decRef, err := dec.CopyReference(RefLast)
+				if err != nil {
+					t.Fatalf("Decoder.CopyReference failed: %v", err)
+				}
+				if encRef.DW != width || encRef.DH != height {
+					t.Errorf("reference size = %dx%d, want %dx%d", encRef.DW, encRef.DH, width, height)
+				}
+				if !equalImages(decRef, last.Image()) {
+					t.Error("decoder last reference differs from the last decoded frame")
+				}
+				if !equalImages(encRef, decRef) {
+					t.Error("encoder and decoder last references differ")
+				}
+
+				if codec == CodecVP8 {
+					encGolden, err := enc.CopyReference(RefGolden)
+					if err != nil {
+						t.Fatalf("Encoder.CopyReference(RefGolden) failed: %v", err)
+					}
+					decGolden, err := dec.CopyReference(RefGolden)
+					if err != nil {
+						t.Fatalf("Decoder.CopyReference(RefGolden) failed: %v", err)
+					}
+					if !equalImages(encGolden, decGolden) {
+						t.Error("encoder and decoder golden references differ")
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSetReferenceRecovery(t *testing.T) {
+	for _, codec := range []Codec{CodecVP8, CodecVP9} {
+		t.Run(codec.String(), func(t *testing.T) {
+			enc, err := NewEncoder(codec, EncoderOptions{
+				Width:          320,
+				Height:         240,
+				Deadline:       DlRealtime,
+				ErrorResilient: ErrorResilientDefault,
+				Configure: func(cfg *CodecEncCfg) {
+					cfg.GLagInFrames = 0
+				},
+			})
+			if err != nil {
+				t.Fatalf("NewEncoder failed: %v", err)
+			}
+			defer enc.Close()
+			full, err := NewDecoder(codec, DecoderOptions{})
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			defer full.Close()
+			lossy, err := NewDecoder(codec, DecoderOptions{})
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			defer lossy.Close()
+
+			img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+			defer ImageFree(img)
+			img.Deref()
+
+			// Frames 2 to 4 are lost. Before frame 5 the receiver restores the
+			// last frame from the sender, as after a reference picture request.
+			keepGolden := EncFrameFlags(0).NoUpdate(RefGolden | RefAltRef)
+			var ref *Image
+			for i := 0; i < 7; i++ {
+				if i == 5 {
+					if err := lossy.SetReference(RefLast, ref); err != nil {
+						t.Fatalf("Decoder.SetReference failed: %v", err)
+					}
+				}
+				fillTestPattern(img, i)
+				pkts, err := enc.Encode(img, CodecPts(i), keepGolden)
+				if err != nil || len(pkts) != 1 {
+					t.Fatalf("Encode frame %d = %d packets, %v", i, len(pkts), err)
+				}
+				if i == 4 {
+					if ref, err = enc.CopyReference(RefLast); err != nil {
+						t.Fatalf("Encoder.CopyReference failed: %v", err)
+					}
+				}
+
+				want, err := full.Decode(pkts[0].Data)
+				if err != nil || len(want) != 1 {
+					t.Fatalf("frame %d: full decode = %d frames, %v", i, len(want), err)
+				}
+				if i >= 2 && i <= 4 {
+					continue
+				}
+				got, err := lossy.Decode(pkts[0].Data)
+				if err != nil || len(got) != 1 {
+					t.Fatalf("frame %d: lossy decode = %d frames, %v", i, len(got), err)
+				}
+				if i >= 5 && !equalImages(got[0].Image(), want[0].Image()) {
+					t.Errorf("frame %d differs from the lossless decode", i)
+				}
+			}
+		})
+	}
+}
+
+func TestEncoderSetReference(t *testing.T) {
+	for _, codec := range []Codec{CodecVP8, CodecVP9} {
+		t.Run(codec.String(), func(t *testing.T) {
+			enc := newRealtimeEncoder(t, codec)
+			encodeOneFrame(t, enc, 0)
+
+			img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+			defer ImageFree(img)
+			img.Deref()
+			fillNoise(img, 7)
+			if err := enc.SetReference(RefGolden, img); err != nil {
+				t.Fatalf("SetReference failed: %v", err)
+			}
+			got, err := enc.CopyReference(RefGolden)
+			if err != nil {
+				t.Fatalf("CopyReference failed: %v", err)
+			}
+			if !equalImages(got, img) {
+				t.Error("golden reference differs from the image it was set to")
+			}
+		})
+	}
+}
+
+func TestDecoderReferenceBuffer(t *testing.T) {
+	packets := encodeTestPackets(t, CodecVP9, 320, 240, 3)
+	dec, err := NewDecoder(CodecVP9, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer dec.Close()
+
+	var last *Frame
+	for _, p := range packets {
+		frames, err := dec.Decode(p.Data)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if len(frames) > 0 {
+			last = frames[len(frames)-1].Clone()
+		}
+	}
+
+	var found bool
+	var buf *Frame
+	for i := 0; i < 8; i++ {
+		f, err := dec.ReferenceBuffer(i)
+		if err != nil {
+			t.Fatalf("ReferenceBuffer(%d) failed: %v", i, err)
+		}
+		if f.Width() != 320 || f.Height() != 240 {
+			t.Errorf("buffer %d is %dx%d, want 320x240", i, f.Width(), f.Height())
+		}
+		found = found || equalImages(f.Image(), last.Image())
+		buf = f
+	}
+	if !found {
+		t.Error("no reference buffer holds the last decoded frame")
+	}
+	if !buf.Borrowed() {
+		t.Error("reference buffer frame is not borrowed")
+	}
+	if _, err := dec.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if buf.Valid() {
+		t.Error("reference buffer frame is still valid after Flush")
+	}
+
+	if _, err := dec.ReferenceBuffer(8); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("ReferenceBuffer(8) = %v, want ErrCodecInvalidParam", err)
+	}
+	vp8, err := NewDecoder(CodecVP8, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer vp8.Close()
+	if _, err := vp8.ReferenceBuffer(0); !errors.Is(err, ErrCodecIncapable) {
+		t.Errorf("VP8 ReferenceBuffer = %v, want ErrCodecIncapable", err)
+	}
+}
+
+func TestReferenceErrors(t *testing.T) {
+	enc := newTestEncoder(t, CodecVP8)
+	if _, err := enc.CopyReference(RefAll); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("CopyReference(RefAll) = %v, want ErrCodecInvalidParam", err)
+	}
+	if err := enc.SetReference(RefLast, nil); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("SetReference(nil) = %v, want ErrCodecInvalidParam", err)
+	}
+	small := ImageAlloc(nil, ImageFormatI420, 160, 120, 1)
+	defer ImageFree(small)
+	small.Deref()
+	if err := enc.SetReference(RefLast, small); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("SetReference(160x120) = %v, want ErrCodecInvalidParam", err)
+	}
+
+	dec, err := NewDecoder(CodecVP8, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	if _, err := dec.CopyReference(RefLast); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("CopyReference before decoding = %v, want ErrCodecInvalidParam", err)
+	}
+	dec.Close()
+	if _, err := dec.CopyReference(RefLast); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("closed: CopyReference = %v, want ErrCodecClosed", err)
+	}
+
+	vp9, err := NewDecoder(CodecVP9, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer vp9.Close()
+	if _, err := vp9.CopyReference(RefGolden); !errors.Is(err, ErrCodecIncapable) {
+		t.Errorf("VP9 CopyReference(RefGolden) = %v, want ErrCodecIncapable", err)
+	}
+
+	enc.Close()
+	if _, err := enc.CopyReference(RefLast); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("closed: CopyReference = %v, want ErrCodecClosed", err)
+	}
+}
@@ -0,0 +1,172 @@
+package vpx
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../include
+#cgo LDFLAGS: -L${SRCDIR}/../lib -lvpx
+#include <vpx/vp8cx.h>
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"fmt"
+	"image"
+	"unsafe"
+)
+
+const (
+	// MaxROISegments is the number of ROI segments VP9 supports.
+	MaxROISegments = 8
+	// MaxVP8ROISegments is the number of ROI segments VP8 supports.
+	MaxVP8ROISegments = 4
+)
+
+// ROIReference restricts the reference frame a VP9 ROI segment predicts from.
+// The zero value leaves the choice to the encoder.
+type ROIReference int
+
+const (
+	ROIReferenceAny ROIReference = iota
+	ROIReferenceIntra
+	ROIReferenceLast
+	ROIReferenceGolden
+	ROIReferenceAltRef
+)
+
+// ROISegment holds the coding parameters applied to the blocks of one segment.
+type ROISegment struct {
+	// DeltaQ is added to the frame quantizer, -63..63.
+	DeltaQ int
+	// DeltaLF is added to the loop filter level, -63..63.
+	DeltaLF int
+	// Skip skips coding residuals of the segment's blocks. VP9 only.
+	Skip bool
+	// Reference forces the reference frame of the segment's blocks. VP9 only.
+	Reference ROIReference
+	// StaticThreshold is the static breakout threshold. VP8 only.
+	StaticThreshold uint32
+}
+
+// ROIMap assigns each block of a frame to a segment with its own quantizer
+// and loop filter deltas. Blocks are 16x16 pixels for VP8 and 8x8 pixels
+// for VP9.
+type ROIMap struct {
+	Codec Codec
+	Rows  int
+	Cols  int
+	// Map holds the segment id of each block in row-major order.
+	Map []uint8
+	// Segments are indexed by segment id. VP8 only uses the first four.
+	Segments [MaxROISegments]ROISegment
+}
+
+// ROIBlockSize returns the edge length in pixels of the blocks an ROI map
+// addresses for codec.
+func ROIBlockSize(codec Codec) int {
+	if codec == CodecVP9 {
+		return 8
+	}
+	return 16
+}
+
+// NewROIMap returns an ROI map covering a width x height frame with every
+// block in segment 0.
+func NewROIMap(codec Codec, width, height int) *ROIMap {
+	size := ROIBlockSize(codec)
+	rows := (height + size - 1) / size
+	cols := (width + size - 1) / size
+	return &ROIMap{
+		Codec: codec,
+		Rows:  rows,
+		Cols:  cols,
+		Map:   make([]uint8, rows*cols),
+	}
+}
+
+// NewROIMapFromSegments returns an ROI map for a width x height frame using
+// segments as the per-block segment ids. segments must hold one id per
+// block in row-major order.
+func NewROIMapFromSegments(codec Codec, width, height int, segments []uint8) (*ROIMap, error) {
+	m := NewROIMap(codec, width, height)
+	if len(segments) != len(m.Map) {
+		return nil, fmt.Errorf("%w: roi map has %d blocks, want %dx%d", ErrCodecInvalidParam, len(segments), m.Rows, m.Cols)
+	}
+	copy(m.Map, segments)
+	return m, m.Validate()
+}
+
+// SetRect assigns every block overlapping rect, in pixel coordinates, to segment.
+func (m *ROIMap) SetRect(rect image.Rectangle, segment uint8) {
+	size := ROIBlockSize(m.Codec)
+	blocks := image.Rect(
+		rect.Min.X/size, rect.Min.Y/size,
+		(rect.Max.X+size-1)/size, (rect.Max.Y+size-1)/size,
+	).Intersect(image.Rect(0, 0, m.Cols, m.Rows))
+	for row := blocks.Min.Y; row < blocks.Max.Y; row++ {
+		for col := blocks.Min.X; col < blocks.Max.X; col++ {
+			m.Map[row*m.Cols+col] = segment
+		}
+	}
+}
+
+// Validate checks the map against the limits of its codec.
+func (m *ROIMap) Validate() error {
+	if m.Rows <= 0 || m.Cols <= 0 || len(m.Map) != m.Rows*m.Cols {
+		return fmt.Errorf("%w: roi map has %d blocks, want %dx%d", ErrCodecInvalidParam, len(m.Map), m.Rows, m.Cols)
+	}
+	segments := MaxROISegments
+	if m.Codec == CodecVP8 {
+		segments = MaxVP8ROISegments
+	}
+	for i, id := range m.Map {
+		if int(id) >= segments {
+			return fmt.Errorf("%w: roi map block %d uses segment %d, %s supports %d", ErrCodecInvalidParam, i, id, m.Codec, segments)
+		}
+	}
+	for i, s := range m.Segments {
+		if err := checkRange("roi delta q", s.DeltaQ, -63, 63); err != nil {
+			return fmt.Errorf("segment %d: %w", i, err)
+		}
+		if err := checkRange("roi delta lf", s.DeltaLF, -63, 63); err != nil {
+			return fmt.Errorf("segment %d: %w", i, err)
+		}
+		if err := checkRange("roi reference", int(s.Reference), int(ROIReferenceAny), int(ROIReferenceAltRef)); err != nil {
+			return fmt.Errorf("segment %d: %w", i, err)
+		}
+		if m.Codec == CodecVP8 && (s.Skip || s.Reference != ROIReferenceAny) {
+			return fmt.Errorf("%w: segment %d: roi skip and reference are only supported by VP9", ErrCodecIncapable, i)
+		}
+		if m.Codec == CodecVP9 && s.StaticThreshold != 0 {
+			return fmt.Errorf("%w: segment %d: roi static threshold is only supported by VP8", ErrCodecIncapable, i)
+		}
+	}
+	return nil
+}
+
+// CodecControlROIMap passes m to VP8ESetROIMap or VP9ESetROIMap.
+// The map is copied into C memory for the duration of the call; libvpx keeps
+// its own copy. A map with an empty Map disables ROI coding.
+func CodecControlROIMap(ctx *CodecCtx, ctrlID int, m *ROIMap) CodecErr {
+	croi := (*C.vpx_roi_map_t)(C.calloc(1, C.sizeof_vpx_roi_map_t))
+	defer C.free(unsafe.Pointer(croi))
+
+	croi.rows = C.uint(m.Rows)
+	croi.cols = C.uint(m.Cols)
+	if len(m.Map) != 0 {
+		croi.enabled = 1
+		croi.roi_map = (*C.uchar)(C.CBytes(m.Map))
+		defer C.free(unsafe.Pointer(croi.roi_map))
+	}
+	for i, s := range m.Segments {
+		croi.delta_q[i] = C.int(s.DeltaQ)
+		croi.delta_lf[i] = C.int(s.DeltaLF)
+		if s.Skip {
+			croi.skip[i] = 1
+		}
+		// libvpx uses -1 for no reference constraint, then INTRA_FRAME..ALTREF_FRAME.
+		croi.ref_frame[i] = C.int(s.Reference) - 1
+		if i < MaxVP8ROISegments {
+			croi.static_threshold[i] = C.uint(s.StaticThreshold)
+		}
+	}
+	return CodecControlPtr(ctx, ctrlID, unsafe.Pointer(croi))
+}
@@ -0,0 +1,197 @@
+package vpx
+
+import (
+	"errors"
+	"image"
+	"testing"
+)
+
+func TestNewROIMap(t *testing.T) {
+	tests := []struct {
+		codec      Codec
+		rows, cols int
+	}{
+		{CodecVP8, 15, 20},
+		{CodecVP9, 30, 40},
+	}
+	for _, tt := range tests {
+		m := NewROIMap(tt.codec, 320, 240)
+		if m.Rows != tt.rows || m.Cols != tt.cols {
+			t.Errorf("%s map is %dx%d, want %dx%d", tt.codec, m.Rows, m.Cols, tt.rows, tt.cols)
+		}
+		if len(m.Map) != tt.rows*tt.cols {
+			t.Errorf("%s map has %d blocks, want %d", tt.codec, len(m.Map), tt.rows*tt.cols)
+		}
+	}
+
+	m := NewROIMap(CodecVP8, 33, 17)
+	if m.Rows != 2 || m.Cols != 3 {
+		t.Errorf("33x17 VP8 map is %dx%d, want 2x3", m.Rows, m.Cols)
+	}
+}
+
+func TestROIMapSetRect(t *testing.T) {
+	m := NewROIMap(CodecVP8, 64, 64)
+	m.SetRect(image.Rect(20, 10, 40, 17), 2)
+	m.SetRect(image.Rect(60, 60, 200, 200), 3)
+
+	want := []uint8{
+		0, 2, 2, 0,
+		0, 2, 2, 0,
+		0, 0, 0, 0,
+		0, 0, 0, 3,
+	}
+	for i := range want {
+		if m.Map[i] != want[i] {
+			t.Fatalf("Map = %v, want %v", m.Map, want)
+		}
+	}
+}
+
+func TestNewROIMapFromSegments(t *testing.T) {
+	segments := make([]uint8, 15*20)
+	segments[0] = 3
+	m, err := NewROIMapFromSegments(CodecVP8, 320, 240, segments)
+	if err != nil {
+		t.Fatalf("NewROIMapFromSegments failed: %v", err)
+	}
+	if m.Map[0] != 3 {
+		t.Errorf("Map[0] = %d, want 3", m.Map[0])
+	}
+
+	if _, err := NewROIMapFromSegments(CodecVP8, 320, 240, segments[:10]); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("short segment slice error = %v, want ErrCodecInvalidParam", err)
+	}
+	segments[0] = 4
+	if _, err := NewROIMapFromSegments(CodecVP8, 320, 240, segments); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("VP8 segment 4 error = %v, want ErrCodecInvalidParam", err)
+	}
+	if _, err := NewROIMapFromSegments(CodecVP9, 16, 16, []uint8{7, 7, 7, 7}); err != nil {
+		t.Errorf("VP9 segment 7 failed: %v", err)
+	}
+}
+
+func TestROIMapValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec Codec
+		seg   ROISegment
+		want  error
+	}{
+		{"delta q", CodecVP8, ROISegment{DeltaQ: 64}, ErrCodecInvalidParam},
+		{"delta lf", CodecVP9, ROISegment{DeltaLF: -64}, ErrCodecInvalidParam},
+		{"reference", CodecVP9, ROISegment{Reference: ROIReferenceAltRef + 1}, ErrCodecInvalidParam},
+		{"vp8 skip", CodecVP8, ROISegment{Skip: true}, ErrCodecIncapable},
+		{"vp8 reference", CodecVP8, ROISegment{Reference: ROIReferenceLast}, ErrCodecIncapable},
+		{"vp9 static threshold", CodecVP9, ROISegment{StaticThreshold: 10}, ErrCodecIncapable},
+		{"vp9 skip", CodecVP9, ROISegment{Skip: true, Reference: ROIReferenceLast}, nil},
+	}
+	for _, tt := range tests {
+		m := NewROIMap(tt.codec, 64, 64)
+		m.Segments[1] = tt.seg
+		if err := m.Validate(); !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+			t.Errorf("%s: Validate = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestEncoderROIMap(t *testing.T) {
+	for _, codec := range []Codec{CodecVP8, CodecVP9} {
+		t.Run(codec.String(), func(t *testing.T) {
+			const width, height = 320, 240
+
+			enc, err := NewEncoder(codec, EncoderOptions{
+				Width:    width,
+				Height:   height,
+				Bitrate:  300,
+				Deadline: DlRealtime,
+				Configure: func(cfg *CodecEncCfg) {
+					cfg.GLagInFrames = 0
+				},
+			})
+			if err != nil {
+				t.Fatalf("NewEncoder failed: %v", err)
+			}
+			defer enc.Close()
+			if err := enc.SetCPUUsed(8); err != nil {
+				t.Fatalf("SetCPUUsed failed: %v", err)
+			}
+
+			// Code the right half of the frame much coarser than the left.
+			m := NewROIMap(codec, width, height)
+			m.SetRect(image.Rect(width/2, 0, width, height), 1)
+			m.Segments[1].DeltaQ = 40
+			if err := enc.SetROIMap(m); err != nil {
+				t.Fatalf("SetROIMap failed: %v", err)
+			}
+
+			dec, err := NewDecoder(codec, DecoderOptions{})
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			defer dec.Close()
+
+			img := ImageAlloc(nil, ImageFormatI420, width, height, 1)
+			defer ImageFree(img)
+			img.Deref()
+
+			var frame *Frame
+			for i := 0; i < 10; i++ {
+				fillTestPattern(img, i)
+				pkts, err := enc.Encode(img, CodecPts(i), 0)
+				if err != nil {
+					t.Fatalf("Encode failed: %v", err)
+				}
+				for _, pkt := range pkts {
+					frames, err := dec.Decode(pkt.Data)
+					if err != nil {
+						t.Fatalf("Decode failed: %v", err)
+					}
+					if len(frames) > 0 {
+						frame = frames[0]
+					}
+				}
+			}
+			if frame == nil {
+				t.Fatal("no frame decoded")
+			}
+
+			srcLeft, srcRight := splitLuma(img)
+			decLeft, decRight := splitLuma(frame.Image())
+			left := calculatePSNR(srcLeft, decLeft)
+			right := calculatePSNR(srcRight, decRight)
+			if right > left-2 {
+				t.Errorf("right half PSNR %.2f dB is not clearly below left half %.2f dB", right, left)
+			}
+
+			if err := enc.ClearROIMap(); err != nil {
+				t.Fatalf("ClearROIMap failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestEncoderROIMapMismatch(t *testing.T) {
+	enc := newTestEncoder(t, CodecVP8)
+
+	if err := enc.SetROIMap(NewROIMap(CodecVP9, 320, 240)); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("VP9 map on VP8 encoder = %v, want ErrCodecInvalidParam", err)
+	}
+	if err := enc.SetROIMap(NewROIMap(CodecVP8, 640, 480)); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("oversized map = %v, want ErrCodecInvalidParam", err)
+	}
+	if err := enc.SetROIMap(nil); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("nil map = %v, want ErrCodecInvalidParam", err)
+	}
+}
+
+// splitLuma returns the visible luma samples of the left and right halves of img.
+func splitLuma(img *Image) (left, right []byte) {
+	y := visiblePlane(img, PlaneY)
+	w, h := int(img.DW), int(img.DH)
+	for row := 0; row < h; row++ {
+		left = append(left, y[row*w:row*w+w/2]...)
+		right = append(right, y[row*w+w/2:row*w+w]...)
+	}
+	return left, right
+}
@@ -0,0 +1,303 @@
+package vpx
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../include
+#cgo LDFLAGS: -L${SRCDIR}/../lib -lvpx
+#include <vpx/vp8cx.h>
+*/
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+// TemporalLayeringMode selects how VP9 assigns temporal layers, as used by
+// CodecEncCfg.TemporalLayeringMode.
+type TemporalLayeringMode int32
+
+const (
+	TemporalLayeringNone   TemporalLayeringMode = C.VP9E_TEMPORAL_LAYERING_MODE_NOLAYERING
+	TemporalLayeringBypass TemporalLayeringMode = C.VP9E_TEMPORAL_LAYERING_MODE_BYPASS
+	TemporalLayering0101   TemporalLayeringMode = C.VP9E_TEMPORAL_LAYERING_MODE_0101
+	TemporalLayering0212   TemporalLayeringMode = C.VP9E_TEMPORAL_LAYERING_MODE_0212
+)
+
+// SVCSpatialLayer configures one VP9 spatial layer.
+type SVCSpatialLayer struct {
+	// ScaleNum/ScaleDen is the layer resolution relative to the input frame.
+	ScaleNum int
+	ScaleDen int
+	// MinQuantizer and MaxQuantizer bound the layer quantizer, 0..63.
+	MinQuantizer int
+	MaxQuantizer int
+	// Bitrates holds the target bitrate in kbps of each temporal layer of this
+	// spatial layer. Rates are cumulative: the rate of temporal layer t
+	// includes the layers below it.
+	Bitrates []uint32
+}
+
+// SVCConfig describes a VP9 scalable video coding setup with up to
+// SsMaxLayers spatial layers and TsMaxLayers temporal layers.
+// Spatial layers are ordered from the lowest to the highest resolution.
+type SVCConfig struct {
+	SpatialLayers  []SVCSpatialLayer
+	TemporalLayers int
+	// Mode selects the temporal pattern. NewSVCConfig picks TemporalLayering0101
+	// or TemporalLayering0212 from TemporalLayers; use TemporalLayeringBypass
+	// to drive layers per frame with Encoder.SetSVCLayerID and
+	// Encoder.SetSVCRefFrameConfig.
+	Mode TemporalLayeringMode
+}
+
+// NewSVCConfig returns a configuration with spatial layers that each halve
+// the resolution of the layer above, the full 0..63 quantizer range and no
+// bitrates. Set the bitrates with SetBitrate before use.
+func NewSVCConfig(spatial, temporal int) *SVCConfig {
+	c := &SVCConfig{
+		SpatialLayers:  make([]SVCSpatialLayer, spatial),
+		TemporalLayers: temporal,
+	}
+	switch temporal {
+	case 2:
+		c.Mode = TemporalLayering0101
+	case 3:
+		c.Mode = TemporalLayering0212
+	}
+	for i := range c.SpatialLayers {
+		c.SpatialLayers[i] = SVCSpatialLayer{
+			ScaleNum:     1,
+			ScaleDen:     1 << (spatial - 1 - i),
+			MaxQuantizer: 63,
+			Bitrates:     make([]uint32, temporal),
+		}
+	}
+	return c
+}
+
+// SetScaling sets the resolution of spatial layer relative to the input.
+func (c *SVCConfig) SetScaling(spatial, num, den int) *SVCConfig {
+	c.SpatialLayers[spatial].ScaleNum = num
+	c.SpatialLayers[spatial].ScaleDen = den
+	return c
+}
+
+// SetQuantizers sets the quantizer range of spatial layer.
+func (c *SVCConfig) SetQuantizers(spatial, min, max int) *SVCConfig {
+	c.SpatialLayers[spatial].MinQuantizer = min
+	c.SpatialLayers[spatial].MaxQuantizer = max
+	return c
+}
+
+// SetBitrate sets the cumulative target bitrate in kbps of a layer.
+func (c *SVCConfig) SetBitrate(spatial, temporal int, kbps uint32) *SVCConfig {
+	c.SpatialLayers[spatial].Bitrates[temporal] = kbps
+	return c
+}
+
+// Validate checks the configuration against the limits of libvpx.
+func (c *SVCConfig) Validate() error {
+	if err := checkRange("svc spatial layers", len(c.SpatialLayers), 1, SsMaxLayers); err != nil {
+		return err
+	}
+	if err := checkRange("svc temporal layers", c.TemporalLayers, 1, TsMaxLayers); err != nil {
+		return err
+	}
+	if n := len(c.SpatialLayers) * c.TemporalLayers; n > MaxLayers {
+		return fmt.Errorf("%w: %d svc layers exceed the limit of %d", ErrCodecInvalidParam, n, MaxLayers)
+	}
+	switch c.Mode {
+	case TemporalLayeringNone:
+		if c.TemporalLayers != 1 {
+			return fmt.Errorf("%w: %d temporal layers need a temporal layering mode", ErrCodecInvalidParam, c.TemporalLayers)
+		}
+	case TemporalLayering0101:
+		if c.TemporalLayers != 2 {
+			return fmt.Errorf("%w: 0101 temporal layering needs 2 temporal layers, not %d", ErrCodecInvalidParam, c.TemporalLayers)
+		}
+	case TemporalLayering0212:
+		if c.TemporalLayers != 3 {
+			return fmt.Errorf("%w: 0212 temporal layering needs 3 temporal layers, not %d", ErrCodecInvalidParam, c.TemporalLayers)
+		}
+	case TemporalLayeringBypass:
+	default:
+		return fmt.Errorf("%w: unknown temporal layering mode %d", ErrCodecInvalidParam, c.Mode)
+	}
+	for i, l := range c.SpatialLayers {
+		if l.ScaleNum <= 0 || l.ScaleDen <= 0 || l.ScaleNum > l.ScaleDen {
+			return fmt.Errorf("%w: spatial layer %d scaling %d/%d is not in (0, 1]", ErrCodecInvalidParam, i, l.ScaleNum, l.ScaleDen)
+		}
+		if err := checkRange("svc min quantizer", l.MinQuantizer, 0, 63); err != nil {
+			return fmt.Errorf("spatial layer %d: %w", i, err)
+		}
+		if err := checkRange("svc max quantizer", l.MaxQuantizer, l.MinQuantizer, 63); err != nil {
+			return fmt.Errorf("spatial layer %d: %w", i, err)
+		}
+		if len(l.Bitrates) != c.TemporalLayers {
+			return fmt.Errorf("%w: spatial layer %d has %d bitrates, want %d", ErrCodecInvalidParam, i, len(l.Bitrates), c.TemporalLayers)
+		}
+		// Unlike VP8 temporal layering, VP9 SVC lets a temporal layer add
+		// nothing to the rate of the one below.
+		for t, kbps := range l.Bitrates {
+			if kbps == 0 || (t > 0 && kbps < l.Bitrates[t-1]) {
+				return fmt.Errorf("%w: spatial layer %d temporal layer %d bitrate %d is not cumulative", ErrCodecInvalidParam, i, t, kbps)
+			}
+		}
+	}
+	return nil
+}
+
+// apply writes the layer structure and bitrates into cfg. The total target
+// bitrate is the sum of the top temporal layer of every spatial layer.
+func (c *SVCConfig) apply(cfg *CodecEncCfg) {
+	cfg.SsNumberLayers = uint32(len(c.SpatialLayers))
+	cfg.TsNumberLayers = uint32(c.TemporalLayers)
+	cfg.TemporalLayeringMode = int32(c.Mode)
+
+	cfg.TsRateDecimator = [TsMaxLayers]uint32{}
+	for t := 0; t < c.TemporalLayers; t++ {
+		cfg.TsRateDecimator[t] = 1 << (c.TemporalLayers - 1 - t)
+	}
+
+	cfg.LayerTargetBitrate = [MaxLayers]uint32{}
+	cfg.SsTargetBitrate = [SsMaxLayers]uint32{}
+	var total uint32
+	for s, l := range c.SpatialLayers {
+		for t, kbps := range l.Bitrates {
+			cfg.LayerTargetBitrate[s*c.TemporalLayers+t] = kbps
+		}
+		top := l.Bitrates[c.TemporalLayers-1]
+		cfg.SsTargetBitrate[s] = top
+		total += top
+	}
+	cfg.RcTargetBitrate = total
+}
+
+// CodecControlSVCParameters applies VP9ESetSVCParameters built from c.
+func CodecControlSVCParameters(ctx *CodecCtx, c *SVCConfig) CodecErr {
+	var params C.vpx_svc_extra_cfg_t
+	params.temporal_layering_mode = C.int(c.Mode)
+	for s, l := range c.SpatialLayers {
+		for t := 0; t < c.TemporalLayers; t++ {
+			i := s*c.TemporalLayers + t
+			params.max_quantizers[i] = C.int(l.MaxQuantizer)
+			params.min_quantizers[i] = C.int(l.MinQuantizer)
+		}
+		params.scaling_factor_num[s] = C.int(l.ScaleNum)
+		params.scaling_factor_den[s] = C.int(l.ScaleDen)
+	}
+	return CodecControlPtr(ctx, VP9ESetSVCParameters, unsafe.Pointer(&params))
+}
+
+// SVCLayerID identifies the layers of a VP9 SVC superframe.
+type SVCLayerID struct {
+	// SpatialLayerID is the first spatial layer to encode.
+	SpatialLayerID int
+	// TemporalLayerID is the temporal layer of the superframe.
+	TemporalLayerID int
+	// TemporalLayerIDs holds the temporal layer of each spatial layer. It is
+	// only used with TemporalLayeringBypass.
+	TemporalLayerIDs [SsMaxLayers]int
+}
+
+// CodecControlSVCLayerID applies VP9ESetSVCLayerID.
+func CodecControlSVCLayerID(ctx *CodecCtx, id SVCLayerID) CodecErr {
+	var cid C.vpx_svc_layer_id_t
+	cid.spatial_layer_id = C.int(id.SpatialLayerID)
+	cid.temporal_layer_id = C.int(id.TemporalLayerID)
+	for i, t := range id.TemporalLayerIDs {
+		cid.temporal_layer_id_per_spatial[i] = C.int(t)
+	}
+	return CodecControlPtr(ctx, VP9ESetSVCLayerID, unsafe.Pointer(&cid))
+}
+
+// CodecControlGetSVCLayerID reads VP9EGetSVCLayerID.
+func CodecControlGetSVCLayerID(ctx *CodecCtx) (SVCLayerID, CodecErr) {
+	var cid C.vpx_svc_layer_id_t
+	err := CodecControlPtr(ctx, VP9EGetSVCLayerID, unsafe.Pointer(&cid))
+	id := SVCLayerID{
+		SpatialLayerID:  int(cid.spatial_layer_id),
+		TemporalLayerID: int(cid.temporal_layer_id),
+	}
+	for i := range id.TemporalLayerIDs {
+		id.TemporalLayerIDs[i] = int(cid.temporal_layer_id_per_spatial[i])
+	}
+	return id, err
+}
+
+// SVCRefFrameConfig selects, for each spatial layer of the next superframe,
+// which of the eight reference buffers serve as last, golden and alt-ref
+// and which buffers the frame refreshes. It requires TemporalLayeringBypass.
+type SVCRefFrameConfig struct {
+	LastIdx   [SsMaxLayers]int
+	GoldenIdx [SsMaxLayers]int
+	AltRefIdx [SsMaxLayers]int
+	// UpdateBufferSlot is a bitmask of the buffers the layer refreshes.
+	UpdateBufferSlot [SsMaxLayers]int
+	ReferenceLast    [SsMaxLayers]bool
+	ReferenceGolden  [SsMaxLayers]bool
+	ReferenceAltRef  [SsMaxLayers]bool
+	// Duration is the frame duration of each layer in timebase units.
+	Duration [SsMaxLayers]int64
+}
+
+// CodecControlSVCRefFrameConfig applies VP9ESetSVCRefFrameConfig.
+func CodecControlSVCRefFrameConfig(ctx *CodecCtx, c *SVCRefFrameConfig) CodecErr {
+	var cc C.vpx_svc_ref_frame_config_t
+	for i := 0; i < SsMaxLayers; i++ {
+		cc.lst_fb_idx[i] = C.int(c.LastIdx[i])
+		cc.gld_fb_idx[i] = C.int(c.GoldenIdx[i])
+		cc.alt_fb_idx[i] = C.int(c.AltRefIdx[i])
+		cc.update_buffer_slot[i] = C.int(c.UpdateBufferSlot[i])
+		cc.reference_last[i] = C.int(boolToInt(c.ReferenceLast[i]))
+		cc.reference_golden[i] = C.int(boolToInt(c.ReferenceGolden[i]))
+		cc.reference_alt_ref[i] = C.int(boolToInt(c.ReferenceAltRef[i]))
+		cc.duration[i] = C.int64_t(c.Duration[i])
+	}
+	return CodecControlPtr(ctx, VP9ESetSVCRefFrameConfig, unsafe.Pointer(&cc))
+}
+
+// enableSVC switches an initialized VP9 encoder to SVC mode with c's layer
+// scaling and quantizers.
+func enableSVC(ctx *CodecCtx, c *SVCConfig) error {
+	if err := codecError(ctx, "set svc", CodecControlInt(ctx, VP9ESetSVC, 1)); err != nil {
+		return err
+	}
+	return codecError(ctx, "set svc parameters", CodecControlSVCParameters(ctx, c))
+}
+
+// SplitSuperframe splits a VP9 superframe into its frames, one per encoded
+// spatial layer from the lowest to the highest. Data without a superframe
+// index is returned as a single frame. The frames alias data.
+func SplitSuperframe(data []byte) ([][]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: empty frame", ErrCodecInvalidParam)
+	}
+	marker := data[len(data)-1]
+	if marker&0xe0 != 0xc0 {
+		return [][]byte{data}, nil
+	}
+	frames := int(marker&0x7) + 1
+	mag := int(marker>>3&0x3) + 1
+	indexSize := 2 + mag*frames
+	if len(data) < indexSize || data[len(data)-indexSize] != marker {
+		// Not an index: the marker byte is part of the frame data.
+		return [][]byte{data}, nil
+	}
+
+	index := data[len(data)-indexSize+1:]
+	payload := data[:len(data)-indexSize]
+	out := make([][]byte, 0, frames)
+	var offset int
+	for i := 0; i < frames; i++ {
+		var size int
+		for b := 0; b < mag; b++ {
+			size |= int(index[i*mag+b]) << (8 * b)
+		}
+		if size > len(payload)-offset {
+			return nil, fmt.Errorf("%w: superframe frame %d size %d exceeds data", ErrCodecCorruptFrame, i, size)
+		}
+		out = append(out, payload[offset:offset+size])
+		offset += size
+	}
+	return out, nil
+}
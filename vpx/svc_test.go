@@ -0,0 +1,440 @@
+package vpx
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestNewSVCConfig(t *testing.T) {
+	c := NewSVCConfig(3, 2).
+		SetBitrate(0, 0, 50).SetBitrate(0, 1, 100).
+		SetBitrate(1, 0, 150).SetBitrate(1, 1, 300).
+		SetBitrate(2, 0, 400).SetBitrate(2, 1, 800).
+		SetQuantizers(2, 4, 56)
+	if c.Mode != TemporalLayering0101 {
+		t.Errorf("Mode = %d, want TemporalLayering0101", c.Mode)
+	}
+	for i, den := range []int{4, 2, 1} {
+		l := c.SpatialLayers[i]
+		if l.ScaleNum != 1 || l.ScaleDen != den {
+			t.Errorf("layer %d scaling = %d/%d, want 1/%d", i, l.ScaleNum, l.ScaleDen, den)
+		}
+	}
+	if l := c.SpatialLayers[2]; l.MinQuantizer != 4 || l.MaxQuantizer != 56 {
+		t.Errorf("layer 2 quantizers = %d..%d, want 4..56", l.MinQuantizer, l.MaxQuantizer)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if NewSVCConfig(1, 3).Mode != TemporalLayering0212 {
+		t.Error("3 temporal layers should default to TemporalLayering0212")
+	}
+}
+
+func TestSVCConfigValidate(t *testing.T) {
+	valid := func() *SVCConfig {
+		return NewSVCConfig(2, 2).
+			SetBitrate(0, 0, 100).SetBitrate(0, 1, 200).
+			SetBitrate(1, 0, 300).SetBitrate(1, 1, 600)
+	}
+	tests := []struct {
+		name   string
+		modify func(c *SVCConfig)
+	}{
+		{"no spatial layers", func(c *SVCConfig) { c.SpatialLayers = nil }},
+		{"too many temporal layers", func(c *SVCConfig) { c.TemporalLayers = TsMaxLayers + 1 }},
+		{"mode mismatch", func(c *SVCConfig) { c.Mode = TemporalLayering0212 }},
+		{"missing mode", func(c *SVCConfig) { c.Mode = TemporalLayeringNone }},
+		{"unknown mode", func(c *SVCConfig) { c.Mode = 42 }},
+		{"upscaling", func(c *SVCConfig) { c.SetScaling(0, 3, 2) }},
+		{"zero scale", func(c *SVCConfig) { c.SetScaling(1, 0, 1) }},
+		{"quantizer range", func(c *SVCConfig) { c.SetQuantizers(0, 40, 20) }},
+		{"quantizer max", func(c *SVCConfig) { c.SetQuantizers(1, 0, 64) }},
+		{"missing bitrate", func(c *SVCConfig) { c.SetBitrate(1, 0, 0) }},
+		{"not cumulative", func(c *SVCConfig) { c.SetBitrate(1, 1, 200) }},
+		{"bitrate count", func(c *SVCConfig) { c.SpatialLayers[0].Bitrates = []uint32{100} }},
+	}
+	for _, tt := range tests {
+		c := valid()
+		tt.modify(c)
+		if err := c.Validate(); !errors.Is(err, ErrCodecInvalidParam) {
+			t.Errorf("%s: Validate = %v, want ErrCodecInvalidParam", tt.name, err)
+		}
+	}
+
+	// libvpx accepts a temporal layer at the rate of the one below.
+	if err := valid().SetBitrate(1, 1, 300).Validate(); err != nil {
+		t.Errorf("equal temporal bitrates: Validate = %v", err)
+	}
+
+	c := NewSVCConfig(3, 5)
+	if err := c.Validate(); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("15 layers: Validate = %v, want ErrCodecInvalidParam", err)
+	}
+}
+
+func TestSVCConfigApply(t *testing.T) {
+	c := NewSVCConfig(2, 3).
+		SetBitrate(0, 0, 50).SetBitrate(0, 1, 80).SetBitrate(0, 2, 100).
+		SetBitrate(1, 0, 200).SetBitrate(1, 1, 300).SetBitrate(1, 2, 400)
+
+	cfg := &CodecEncCfg{}
+	c.apply(cfg)
+	if cfg.SsNumberLayers != 2 || cfg.TsNumberLayers != 3 {
+		t.Errorf("layers = %dx%d, want 2x3", cfg.SsNumberLayers, cfg.TsNumberLayers)
+	}
+	if cfg.TemporalLayeringMode != int32(TemporalLayering0212) {
+		t.Errorf("TemporalLayeringMode = %d, want %d", cfg.TemporalLayeringMode, TemporalLayering0212)
+	}
+	if got, want := cfg.TsRateDecimator[:3], []uint32{4, 2, 1}; !equalUint32(got, want) {
+		t.Errorf("TsRateDecimator = %v, want %v", got, want)
+	}
+	if got, want := cfg.LayerTargetBitrate[:6], []uint32{50, 80, 100, 200, 300, 400}; !equalUint32(got, want) {
+		t.Errorf("LayerTargetBitrate = %v, want %v", got, want)
+	}
+	if got, want := cfg.SsTargetBitrate[:2], []uint32{100, 400}; !equalUint32(got, want) {
+		t.Errorf("SsTargetBitrate = %v, want %v", got, want)
+	}
+	if cfg.RcTargetBitrate != 500 {
+		t.Errorf("RcTargetBitrate = %d, want 500", cfg.RcTargetBitrate)
+	}
+}
+
+func equalUint32(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// newSVCEncoder returns a 320x240 realtime VP9 encoder with two spatial
+// layers. Error resilience lets the base layer decode on its own.
+func newSVCEncoder(t *testing.T, svc *SVCConfig) *Encoder {
+	t.Helper()
+
+	enc, err := NewEncoder(CodecVP9, EncoderOptions{
+		Width:          320,
+		Height:         240,
+		RateControl:    Cbr,
+		Deadline:       DlRealtime,
+		ErrorResilient: ErrorResilientDefault,
+		SVC:            svc,
+		Configure: func(cfg *CodecEncCfg) {
+			cfg.GLagInFrames = 0
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	t.Cleanup(func() { enc.Close() })
+	if err := enc.SetCPUUsed(7); err != nil {
+		t.Fatalf("SetCPUUsed failed: %v", err)
+	}
+	return enc
+}
+
+func TestEncoderSVC(t *testing.T) {
+	svc := NewSVCConfig(2, 2).
+		SetBitrate(0, 0, 100).SetBitrate(0, 1, 200).
+		SetBitrate(1, 0, 300).SetBitrate(1, 1, 600)
+	enc := newSVCEncoder(t, svc)
+
+	full, err := NewDecoder(CodecVP9, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer full.Close()
+	base, err := NewDecoder(CodecVP9, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer base.Close()
+
+	img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+	defer ImageFree(img)
+	img.Deref()
+
+	for i := 0; i < 6; i++ {
+		fillTestPattern(img, i)
+		pkts, err := enc.Encode(img, CodecPts(i), 0)
+		if err != nil {
+			t.Fatalf("Encode frame %d failed: %v", i, err)
+		}
+		if len(pkts) != 1 {
+			t.Fatalf("frame %d: got %d packets, want 1", i, len(pkts))
+		}
+
+		id, err := enc.SVCLayerID()
+		if err != nil {
+			t.Fatalf("SVCLayerID failed: %v", err)
+		}
+		if id.TemporalLayerID != i%2 {
+			t.Errorf("frame %d: temporal layer = %d, want %d", i, id.TemporalLayerID, i%2)
+		}
+
+		layers, err := SplitSuperframe(pkts[0].Data)
+		if err != nil {
+			t.Fatalf("SplitSuperframe failed: %v", err)
+		}
+		if len(layers) != 2 {
+			t.Fatalf("frame %d: superframe holds %d frames, want 2", i, len(layers))
+		}
+
+		frames, err := full.Decode(pkts[0].Data)
+		if err != nil {
+			t.Fatalf("frame %d: full decode failed: %v", i, err)
+		}
+		if len(frames) != 1 || frames[0].Width() != 320 || frames[0].Height() != 240 {
+			t.Fatalf("frame %d: full decode = %d frames, want one 320x240 frame", i, len(frames))
+		}
+
+		frames, err = base.Decode(layers[0])
+		if err != nil {
+			t.Fatalf("frame %d: base layer decode failed: %v", i, err)
+		}
+		if len(frames) != 1 || frames[0].Width() != 160 || frames[0].Height() != 120 {
+			t.Fatalf("frame %d: base layer decode = %d frames, want one 160x120 frame", i, len(frames))
+		}
+	}
+}
+
+func TestEncoderSVCBypass(t *testing.T) {
+	svc := NewSVCConfig(2, 1).SetBitrate(0, 0, 100).SetBitrate(1, 0, 300)
+	svc.Mode = TemporalLayeringBypass
+	enc := newSVCEncoder(t, svc)
+
+	dec, err := NewDecoder(CodecVP9, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer dec.Close()
+
+	img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+	defer ImageFree(img)
+	img.Deref()
+
+	for i := 0; i < 4; i++ {
+		if err := enc.SetSVCLayerID(SVCLayerID{}); err != nil {
+			t.Fatalf("SetSVCLayerID failed: %v", err)
+		}
+		// Each layer predicts from its own previous frame in buffer s;
+		// the top layer also predicts from the base layer.
+		ref := &SVCRefFrameConfig{
+			LastIdx:          [SsMaxLayers]int{0, 1},
+			UpdateBufferSlot: [SsMaxLayers]int{1 << 0, 1 << 1},
+			ReferenceLast:    [SsMaxLayers]bool{i > 0, i > 0},
+			ReferenceGolden:  [SsMaxLayers]bool{false, true},
+		}
+		if err := enc.SetSVCRefFrameConfig(ref); err != nil {
+			t.Fatalf("SetSVCRefFrameConfig failed: %v", err)
+		}
+
+		fillTestPattern(img, i)
+		pkts, err := enc.Encode(img, CodecPts(i), 0)
+		if err != nil {
+			t.Fatalf("Encode frame %d failed: %v", i, err)
+		}
+		for _, pkt := range pkts {
+			frames, err := dec.Decode(pkt.Data)
+			if err != nil {
+				t.Fatalf("frame %d: decode failed: %v", i, err)
+			}
+			if len(frames) != 1 {
+				t.Fatalf("frame %d: decoded %d frames, want 1", i, len(frames))
+			}
+		}
+	}
+}
+
+func TestEncoderSVCErrors(t *testing.T) {
+	svc := NewSVCConfig(2, 2).
+		SetBitrate(0, 0, 100).SetBitrate(0, 1, 200).
+		SetBitrate(1, 0, 300).SetBitrate(1, 1, 600)
+
+	if _, err := NewEncoder(CodecVP8, EncoderOptions{Width: 320, Height: 240, SVC: svc}); !errors.Is(err, ErrCodecIncapable) {
+		t.Errorf("VP8 svc: NewEncoder = %v, want ErrCodecIncapable", err)
+	}
+	if _, err := NewEncoder(CodecVP9, EncoderOptions{Width: 320, Height: 240, SVC: NewSVCConfig(2, 2)}); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("missing bitrates: NewEncoder = %v, want ErrCodecInvalidParam", err)
+	}
+
+	enc := newSVCEncoder(t, svc)
+	for _, id := range []SVCLayerID{
+		{SpatialLayerID: 2},
+		{SpatialLayerID: -1},
+		{TemporalLayerID: 2},
+		{TemporalLayerIDs: [SsMaxLayers]int{0, 2}},
+	} {
+		if err := enc.SetSVCLayerID(id); !errors.Is(err, ErrCodecInvalidParam) {
+			t.Errorf("SetSVCLayerID(%+v) = %v, want ErrCodecInvalidParam", id, err)
+		}
+	}
+	if err := enc.SetSVCRefFrameConfig(nil); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("SetSVCRefFrameConfig(nil) = %v, want ErrCodecInvalidParam", err)
+	}
+	if err := enc.SetSVCRefFrameConfig(&SVCRefFrameConfig{LastIdx: [SsMaxLayers]int{8}}); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("SetSVCRefFrameConfig(last 8) = %v, want ErrCodecInvalidParam", err)
+	}
+
+	vp8 := newTestEncoder(t, CodecVP8)
+	if err := vp8.SetSVCLayerID(SVCLayerID{}); !errors.Is(err, ErrCodecIncapable) {
+		t.Errorf("VP8 SetSVCLayerID = %v, want ErrCodecIncapable", err)
+	}
+	if _, err := vp8.SVCLayerID(); !errors.Is(err, ErrCodecIncapable) {
+		t.Errorf("VP8 SVCLayerID = %v, want ErrCodecIncapable", err)
+	}
+}
+
+func TestSplitSuperframe(t *testing.T) {
+	a := []byte{1, 2, 3}
+	b := bytes.Repeat([]byte{4}, 300)
+	// Two frames with 2-byte sizes: marker 0b110_01_001.
+	marker := byte(0xc0 | 1<<3 | 1)
+	index := []byte{marker, 3, 0, 44, 1, marker}
+	data := append(append(append([]byte{}, a...), b...), index...)
+
+	frames, err := SplitSuperframe(data)
+	if err != nil {
+		t.Fatalf("SplitSuperframe failed: %v", err)
+	}
+	if len(frames) != 2 || !bytes.Equal(frames[0], a) || !bytes.Equal(frames[1], b) {
+		t.Errorf("SplitSuperframe = %d frames, want [a b]", len(frames))
+	}
+
+	plain := []byte{0x82, 0x49, 0x83}
+	if frames, err := SplitSuperframe(plain); err != nil || len(frames) != 1 || !bytes.Equal(frames[0], plain) {
+		t.Errorf("plain frame: SplitSuperframe = %v, %v", frames, err)
+	}
+
+	corrupt := append(append([]byte{}, a...), index...)
+	if _, err := SplitSuperframe(corrupt); !errors.Is(err, ErrCodecCorruptFrame) {
+		t.Errorf("corrupt index: SplitSuperframe = %v, want ErrCodecCorruptFrame", err)
+	}
+	if _, err := SplitSuperframe(nil); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("empty: SplitSuperframe = %v, want ErrCodecInvalidParam", err)
+	}
+}
+
+func TestDecoderSpatialLayers(t *testing.T) {
+	svc := NewSVCConfig(2, 1).SetBitrate(0, 0, 100).SetBitrate(1, 0, 300)
+	enc := newSVCEncoder(t, svc)
+
+	img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+	defer ImageFree(img)
+	img.Deref()
+
+	var stream [][]byte
+	for i := 0; i < 6; i++ {
+		fillTestPattern(img, i)
+		var flags EncFrameFlags
+		if i == 4 {
+			flags = flags.ForceKeyframe()
+		}
+		pkts, err := enc.Encode(img, CodecPts(i), flags)
+		if err != nil || len(pkts) != 1 {
+			t.Fatalf("Encode frame %d = %d packets, %v", i, len(pkts), err)
+		}
+		stream = append(stream, pkts[0].Data)
+	}
+
+	tests := []struct {
+		layers        int
+		width, height int
+	}{
+		{0, 320, 240},
+		{1, 160, 120},
+		{2, 320, 240},
+		{SsMaxLayers, 320, 240},
+	}
+	for _, tt := range tests {
+		dec, err := NewDecoder(CodecVP9, DecoderOptions{SpatialLayers: tt.layers})
+		if err != nil {
+			t.Fatalf("NewDecoder(SpatialLayers %d) failed: %v", tt.layers, err)
+		}
+		base, err := NewDecoder(CodecVP9, DecoderOptions{})
+		if err != nil {
+			t.Fatalf("NewDecoder failed: %v", err)
+		}
+		for i, data := range stream {
+			frames, err := dec.Decode(data)
+			if err != nil || len(frames) != 1 {
+				t.Fatalf("layers %d, frame %d: decode = %d frames, %v", tt.layers, i, len(frames), err)
+			}
+			if w, h := frames[0].Width(), frames[0].Height(); w != tt.width || h != tt.height {
+				t.Errorf("layers %d, frame %d: decoded %dx%d, want %dx%d", tt.layers, i, w, h, tt.width, tt.height)
+			}
+			if tt.layers != 1 {
+				continue
+			}
+			layers, err := SplitSuperframe(data)
+			if err != nil {
+				t.Fatalf("SplitSuperframe failed: %v", err)
+			}
+			want, err := base.Decode(layers[0])
+			if err != nil || len(want) != 1 {
+				t.Fatalf("frame %d: base layer decode = %d frames, %v", i, len(want), err)
+			}
+			if !equalImages(frames[0].Image(), want[0].Image()) {
+				t.Errorf("frame %d differs from decoding the base layer alone", i)
+			}
+		}
+		dec.Close()
+		base.Close()
+	}
+
+	// Switch from the base layer to the full resolution at the keyframe.
+	full, err := NewDecoder(CodecVP9, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer full.Close()
+	dec, err := NewDecoder(CodecVP9, DecoderOptions{SpatialLayers: 1})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer dec.Close()
+	for i, data := range stream {
+		if i == 4 {
+			if err := dec.SetSpatialLayers(0); err != nil {
+				t.Fatalf("SetSpatialLayers(0) failed: %v", err)
+			}
+		}
+		want, err := full.Decode(data)
+		if err != nil || len(want) != 1 {
+			t.Fatalf("frame %d: full decode = %d frames, %v", i, len(want), err)
+		}
+		got, err := dec.Decode(data)
+		if err != nil || len(got) != 1 {
+			t.Fatalf("frame %d: decode = %d frames, %v", i, len(got), err)
+		}
+		if i >= 4 && !equalImages(got[0].Image(), want[0].Image()) {
+			t.Errorf("frame %d differs from the full decode after switching up", i)
+		}
+	}
+}
+
+func TestDecoderSpatialLayersErrors(t *testing.T) {
+	if _, err := NewDecoder(CodecVP8, DecoderOptions{SpatialLayers: 1}); !errors.Is(err, ErrCodecIncapable) {
+		t.Errorf("VP8 SpatialLayers = %v, want ErrCodecIncapable", err)
+	}
+	if _, err := NewDecoder(CodecVP9, DecoderOptions{SpatialLayers: SsMaxLayers + 1}); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("SpatialLayers %d = %v, want ErrCodecInvalidParam", SsMaxLayers+1, err)
+	}
+	dec, err := NewDecoder(CodecVP9, DecoderOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	if err := dec.SetSpatialLayers(-1); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("SetSpatialLayers(-1) = %v, want ErrCodecInvalidParam", err)
+	}
+	dec.Close()
+	if err := dec.SetSpatialLayers(1); !errors.Is(err, ErrCodecClosed) {
+		t.Errorf("closed: SetSpatialLayers = %v, want ErrCodecClosed", err)
+	}
+}
@@ -0,0 +1,143 @@
+package vpx
+
+import (
+	"fmt"
+	"slices"
+)
+
+// temporalFrame is one step of a temporal layering pattern.
+type temporalFrame struct {
+	layer int
+	flags EncFrameFlags
+}
+
+// temporalPatterns are indexed by the number of layers. Layer 0 predicts
+// from and refreshes the last frame only, so it decodes on its own. Layer 1
+// keeps its own chain in the golden frame. Layer 2 refreshes nothing and
+// may be dropped freely. Frames above layer 0 never update the entropy
+// context, which would otherwise desynchronize receivers of fewer layers.
+var temporalPatterns = [...][]temporalFrame{
+	1: {
+		{0, 0},
+	},
+	2: {
+		{0, EflagNoRefGF | EflagNoRefARF | EflagNoUpdGF | EflagNoUpdARF},
+		{1, EflagNoRefARF | EflagNoUpdLast | EflagNoUpdARF | EflagNoUpdEntropy},
+	},
+	3: {
+		{0, EflagNoRefGF | EflagNoRefARF | EflagNoUpdGF | EflagNoUpdARF},
+		{2, EflagNoRefGF | EflagNoRefARF | EflagNoUpdLast | EflagNoUpdGF | EflagNoUpdARF | EflagNoUpdEntropy},
+		{1, EflagNoRefARF | EflagNoUpdLast | EflagNoUpdARF | EflagNoUpdEntropy},
+		{2, EflagNoRefARF | EflagNoUpdLast | EflagNoUpdGF | EflagNoUpdARF | EflagNoUpdEntropy},
+	},
+}
+
+// TemporalLayering drives VP8 temporal scalability with one of the preset
+// patterns of libvpx's scalable patterns example: 2 layers alternating
+// 0,1 or 3 layers repeating 0,2,1,2. Each layer runs at twice the frame
+// rate of the layer below it. Pass it as EncoderOptions.TemporalLayering
+// to have the Encoder set the frame flags and layer id of every frame. The
+// encoder steps through a copy of it, so one layering may configure
+// several encoders, such as the streams of a simulcast.
+type TemporalLayering struct {
+	// Bitrates holds the target bitrate in kbps of each layer. Rates are
+	// cumulative: the rate of layer t includes the layers below it.
+	Bitrates []uint32
+
+	layers  int
+	pattern []temporalFrame
+	frame   int
+}
+
+// NewTemporalLayering returns the preset pattern for 1 to 3 temporal layers
+// with no bitrates. Set the bitrates with SetBitrate before use.
+func NewTemporalLayering(layers int) (*TemporalLayering, error) {
+	if err := checkRange("temporal layers", layers, 1, len(temporalPatterns)-1); err != nil {
+		return nil, err
+	}
+	return &TemporalLayering{
+		Bitrates: make([]uint32, layers),
+		layers:   layers,
+		pattern:  temporalPatterns[layers],
+	}, nil
+}
+
+// SetBitrate sets the cumulative target bitrate in kbps of layer.
+func (l *TemporalLayering) SetBitrate(layer int, kbps uint32) *TemporalLayering {
+	l.Bitrates[layer] = kbps
+	return l
+}
+
+// Layers returns the number of temporal layers.
+func (l *TemporalLayering) Layers() int {
+	return l.layers
+}
+
+// Periodicity returns the number of frames after which the pattern repeats.
+func (l *TemporalLayering) Periodicity() int {
+	return len(l.pattern)
+}
+
+// Next returns the layer and frame flags of the next frame and advances the
+// pattern.
+func (l *TemporalLayering) Next() (layer int, flags EncFrameFlags) {
+	f := l.pattern[l.frame%len(l.pattern)]
+	l.frame++
+	return f.layer, f.flags
+}
+
+// clone returns a copy of the layering that starts at the first frame of
+// the pattern, for an encoder to step through on its own.
+func (l *TemporalLayering) clone() *TemporalLayering {
+	if l == nil {
+		return nil
+	}
+	c := *l
+	c.Bitrates = slices.Clone(l.Bitrates)
+	c.frame = 0
+	return &c
+}
+
+// Reset restarts the pattern at its first frame, as after a keyframe.
+func (l *TemporalLayering) Reset() {
+	l.frame = 0
+}
+
+// Validate checks that the layering has a pattern and cumulative bitrates,
+// each layer adding to the rate of the one below as libvpx requires.
+func (l *TemporalLayering) Validate() error {
+	if len(l.pattern) == 0 {
+		return fmt.Errorf("%w: temporal layering has no pattern, use NewTemporalLayering", ErrCodecInvalidParam)
+	}
+	if len(l.Bitrates) != l.layers {
+		return fmt.Errorf("%w: temporal layering has %d bitrates, want %d", ErrCodecInvalidParam, len(l.Bitrates), l.layers)
+	}
+	for t, kbps := range l.Bitrates {
+		if kbps == 0 || (t > 0 && kbps <= l.Bitrates[t-1]) {
+			return fmt.Errorf("%w: temporal layer %d bitrate %d is not cumulative", ErrCodecInvalidParam, t, kbps)
+		}
+	}
+	return nil
+}
+
+// apply writes the layer structure and bitrates into cfg. The total target
+// bitrate is the rate of the top layer.
+func (l *TemporalLayering) apply(cfg *CodecEncCfg) {
+	layers := l.layers
+	cfg.TsNumberLayers = uint32(layers)
+	cfg.TsPeriodicity = uint32(len(l.pattern))
+
+	cfg.TsLayerID = [TsMaxPeriodicity]uint32{}
+	for i, f := range l.pattern {
+		cfg.TsLayerID[i] = uint32(f.layer)
+	}
+	cfg.TsRateDecimator = [TsMaxLayers]uint32{}
+	cfg.TsTargetBitrate = [TsMaxLayers]uint32{}
+	cfg.LayerTargetBitrate = [MaxLayers]uint32{}
+	for t, kbps := range l.Bitrates {
+		cfg.TsRateDecimator[t] = 1 << (layers - 1 - t)
+		cfg.TsTargetBitrate[t] = kbps
+		cfg.LayerTargetBitrate[t] = kbps
+	}
+	cfg.RcTargetBitrate = l.Bitrates[layers-1]
+}
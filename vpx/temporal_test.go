@@ -0,0 +1,190 @@
+package vpx
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTemporalLayeringPatterns(t *testing.T) {
+	tests := []struct {
+		layers int
+		want   []int
+	}{
+		{1, []int{0, 0, 0, 0}},
+		{2, []int{0, 1, 0, 1}},
+		{3, []int{0, 2, 1, 2, 0, 2, 1, 2}},
+	}
+	for _, tt := range tests {
+		l, err := NewTemporalLayering(tt.layers)
+		if err != nil {
+			t.Fatalf("NewTemporalLayering(%d) failed: %v", tt.layers, err)
+		}
+		if l.Layers() != tt.layers {
+			t.Errorf("%d layers: Layers = %d", tt.layers, l.Layers())
+		}
+		for i, want := range tt.want {
+			layer, flags := l.Next()
+			if layer != want {
+				t.Errorf("%d layers: frame %d layer = %d, want %d", tt.layers, i, layer, want)
+			}
+			if layer > 0 && flags&EflagNoUpdLast == 0 {
+				t.Errorf("%d layers: frame %d in layer %d updates the last frame", tt.layers, i, layer)
+			}
+			if layer == 2 && flags&EflagNoUpdGF == 0 {
+				t.Errorf("%d layers: frame %d in layer 2 updates the golden frame", tt.layers, i)
+			}
+		}
+		l.Reset()
+		if layer, _ := l.Next(); layer != 0 {
+			t.Errorf("%d layers: layer after Reset = %d, want 0", tt.layers, layer)
+		}
+	}
+
+	for _, layers := range []int{0, 4} {
+		if _, err := NewTemporalLayering(layers); !errors.Is(err, ErrCodecInvalidParam) {
+			t.Errorf("NewTemporalLayering(%d) = %v, want ErrCodecInvalidParam", layers, err)
+		}
+	}
+}
+
+func TestTemporalLayeringValidate(t *testing.T) {
+	l, _ := NewTemporalLayering(3)
+	if err := l.Validate(); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("missing bitrates: Validate = %v, want ErrCodecInvalidParam", err)
+	}
+	l.SetBitrate(0, 100).SetBitrate(1, 80).SetBitrate(2, 300)
+	if err := l.Validate(); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("not cumulative: Validate = %v, want ErrCodecInvalidParam", err)
+	}
+	l.SetBitrate(1, 100)
+	if err := l.Validate(); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("equal bitrates: Validate = %v, want ErrCodecInvalidParam", err)
+	}
+	l.SetBitrate(1, 160)
+	if err := l.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+	l.Bitrates = l.Bitrates[:2]
+	if err := l.Validate(); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("bitrate count: Validate = %v, want ErrCodecInvalidParam", err)
+	}
+	if err := (&TemporalLayering{}).Validate(); !errors.Is(err, ErrCodecInvalidParam) {
+		t.Errorf("zero value: Validate = %v, want ErrCodecInvalidParam", err)
+	}
+}
+
+func TestTemporalLayeringApply(t *testing.T) {
+	l, _ := NewTemporalLayering(3)
+	l.SetBitrate(0, 100).SetBitrate(1, 160).SetBitrate(2, 250)
+
+	cfg := &CodecEncCfg{}
+	l.apply(cfg)
+	if cfg.TsNumberLayers != 3 || cfg.TsPeriodicity != 4 {
+		t.Errorf("layers = %d, periodicity = %d, want 3 and 4", cfg.TsNumberLayers, cfg.TsPeriodicity)
+	}
+	if got, want := cfg.TsLayerID[:4], []uint32{0, 2, 1, 2}; !equalUint32(got, want) {
+		t.Errorf("TsLayerID = %v, want %v", got, want)
+	}
+	if got, want := cfg.TsRateDecimator[:3], []uint32{4, 2, 1}; !equalUint32(got, want) {
+		t.Errorf("TsRateDecimator = %v, want %v", got, want)
+	}
+	if got, want := cfg.TsTargetBitrate[:3], []uint32{100, 160, 250}; !equalUint32(got, want) {
+		t.Errorf("TsTargetBitrate = %v, want %v", got, want)
+	}
+	if cfg.RcTargetBitrate != 250 {
+		t.Errorf("RcTargetBitrate = %d, want 250", cfg.RcTargetBitrate)
+	}
+}
+
+func TestEncoderTemporalLayering(t *testing.T) {
+	l, _ := NewTemporalLayering(3)
+	l.SetBitrate(0, 150).SetBitrate(1, 250).SetBitrate(2, 400)
+	// Encoders start at the first frame of the pattern, whatever the state
+	// of the layering passed to them.
+	l.Next()
+	opts := EncoderOptions{
+		Width:            320,
+		Height:           240,
+		RateControl:      Cbr,
+		Deadline:         DlRealtime,
+		TemporalLayering: l,
+		Configure: func(cfg *CodecEncCfg) {
+			cfg.GLagInFrames = 0
+		},
+	}
+	enc, err := NewEncoder(CodecVP8, opts)
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	defer enc.Close()
+	// A second encoder sharing the layering, as in simulcast, keeps its own
+	// place in the pattern.
+	shared, err := NewEncoder(CodecVP8, opts)
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	defer shared.Close()
+
+	img := ImageAlloc(nil, ImageFormatI420, 320, 240, 1)
+	defer ImageFree(img)
+	img.Deref()
+
+	var packets, sharedPackets []Packet
+	for i := 0; i < 16; i++ {
+		fillTestPattern(img, i)
+		pkts, err := enc.Encode(img, CodecPts(i), 0)
+		if err != nil {
+			t.Fatalf("Encode frame %d failed: %v", i, err)
+		}
+		packets = append(packets, pkts...)
+		if pkts, err = shared.Encode(img, CodecPts(i), 0); err != nil {
+			t.Fatalf("shared: Encode frame %d failed: %v", i, err)
+		}
+		sharedPackets = append(sharedPackets, pkts...)
+	}
+	if len(packets) != 16 || len(sharedPackets) != 16 {
+		t.Fatalf("got %d and %d packets, want 16", len(packets), len(sharedPackets))
+	}
+	pattern := []int{0, 2, 1, 2}
+	for i := range packets {
+		if packets[i].TemporalLayer != pattern[i%4] || sharedPackets[i].TemporalLayer != pattern[i%4] {
+			t.Errorf("packet %d layers = %d and %d, want %d",
+				i, packets[i].TemporalLayer, sharedPackets[i].TemporalLayer, pattern[i%4])
+		}
+	}
+	if layer, _ := l.Next(); layer != 2 {
+		t.Errorf("encoders advanced the shared layering to layer %d, want 2", layer)
+	}
+
+	// A receiver of the first n layers must decode every frame it gets.
+	for n := 1; n <= 3; n++ {
+		dec, err := NewDecoder(CodecVP8, DecoderOptions{})
+		if err != nil {
+			t.Fatalf("NewDecoder failed: %v", err)
+		}
+		var decoded int
+		for _, p := range packets {
+			if p.TemporalLayer >= n {
+				continue
+			}
+			frames, err := dec.Decode(p.Data)
+			if err != nil {
+				t.Fatalf("%d layers: decoding pts %d failed: %v", n, p.Pts, err)
+			}
+			decoded += len(frames)
+		}
+		dec.Close()
+		if want := 16 >> (3 - n); decoded != want {
+			t.Errorf("%d layers: decoded %d frames, want %d", n, decoded, want)
+		}
+	}
+}
+
+func TestEncoderTemporalLayeringVP9(t *testing.T) {
+	l, _ := NewTemporalLayering(2)
+	l.SetBitrate(0, 100).SetBitrate(1, 200)
+	_, err := NewEncoder(CodecVP9, EncoderOptions{Width: 320, Height: 240, TemporalLayering: l})
+	if !errors.Is(err, ErrCodecIncapable) {
+		t.Errorf("NewEncoder = %v, want ErrCodecIncapable", err)
+	}
+}
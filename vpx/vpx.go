@@ -286,34 +286,3 @@ func CodecGetFrame(ctx *CodecCtx, iter *CodecIter) *Image {
 	__v := NewImageRef(unsafe.Pointer(__ret))
 	return __v
 }
-
-// CodecRegisterPutFrameCb function as declared in vpx-1.15.2/vpx_decoder.h:279
-func CodecRegisterPutFrameCb(ctx *CodecCtx, cb CodecPutFrameCbFn, userPriv unsafe.Pointer) CodecErr {
-	cctx, _ := (*C.vpx_codec_ctx_t)(unsafe.Pointer(ctx)), cgoAllocsUnknown
-	ccb, _ := cb.PassValue()
-	cuserPriv, _ := userPriv, cgoAllocsUnknown
-	__ret := C.vpx_codec_register_put_frame_cb(cctx, ccb, cuserPriv)
-	__v := (CodecErr)(__ret)
-	return __v
-}
-
-// CodecRegisterPutSliceCb function as declared in vpx-1.15.2/vpx_decoder.h:321
-func CodecRegisterPutSliceCb(ctx *CodecCtx, cb CodecPutSliceCbFn, userPriv unsafe.Pointer) CodecErr {
-	cctx, _ := (*C.vpx_codec_ctx_t)(unsafe.Pointer(ctx)), cgoAllocsUnknown
-	ccb, _ := cb.PassValue()
-	cuserPriv, _ := userPriv, cgoAllocsUnknown
-	__ret := C.vpx_codec_register_put_slice_cb(cctx, ccb, cuserPriv)
-	__v := (CodecErr)(__ret)
-	return __v
-}
-
-// CodecSetFrameBufferFunctions function as declared in vpx-1.15.2/vpx_decoder.h:366
-func CodecSetFrameBufferFunctions(ctx *CodecCtx, cbGet GetFrameBufferCbFn, cbRelease ReleaseFrameBufferCbFn, cbPriv unsafe.Pointer) CodecErr {
-	cctx, _ := (*C.vpx_codec_ctx_t)(unsafe.Pointer(ctx)), cgoAllocsUnknown
-	ccbGet, _ := cbGet.PassValue()
-	ccbRelease, _ := cbRelease.PassValue()
-	ccbPriv, _ := cbPriv, cgoAllocsUnknown
-	__ret := C.vpx_codec_set_frame_buffer_functions(cctx, ccbGet, ccbRelease, ccbPriv)
-	__v := (CodecErr)(__ret)
-	return __v
-}